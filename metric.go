@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/tlog"
 	"github.com/trivago/tgo/tmath"
 )
 
@@ -44,6 +45,39 @@ const (
 	MetricMemoryNumObjects = "GoMemoryNumObjects"
 	// MetricMemoryGCEnabled holds 1 or 0 depending on the state of garbage collection
 	MetricMemoryGCEnabled = "GoMemoryGCEnabled"
+	// MetricMemoryHeapInUse holds the number of bytes in in-use heap spans
+	MetricMemoryHeapInUse = "GoMemoryHeapInUse"
+	// MetricMemoryHeapIdle holds the number of bytes in idle heap spans
+	MetricMemoryHeapIdle = "GoMemoryHeapIdle"
+	// MetricMemoryHeapReleased holds the number of heap bytes returned to the OS
+	MetricMemoryHeapReleased = "GoMemoryHeapReleased"
+	// MetricMemoryStackInUse holds the number of bytes used by stacks
+	MetricMemoryStackInUse = "GoMemoryStackInUse"
+	// MetricMemoryTotalAllocated holds the total number of bytes allocated
+	// since the process started
+	MetricMemoryTotalAllocated = "GoMemoryTotalAllocated"
+	// MetricGCNum holds the number of completed garbage collections
+	MetricGCNum = "GoGCNum"
+	// MetricGCPause50 holds the median garbage collection pause in nanoseconds
+	MetricGCPause50 = "GoGCPause50"
+	// MetricGCPause90 holds the 90th percentile of garbage collection pauses
+	// in nanoseconds
+	MetricGCPause90 = "GoGCPause90"
+	// MetricGCPause99 holds the 99th percentile of garbage collection pauses
+	// in nanoseconds
+	MetricGCPause99 = "GoGCPause99"
+	// MetricGCPauseMax holds the longest garbage collection pause in
+	// nanoseconds
+	MetricGCPauseMax = "GoGCPauseMax"
+	// MetricProcessCPUSeconds holds the user and system CPU time consumed by
+	// this process in seconds. This metric is stored as float metric.
+	MetricProcessCPUSeconds = "ProcessCPUSeconds"
+	// MetricProcessOpenFiles holds the number of open file descriptors.
+	// This metric is not available on Windows.
+	MetricProcessOpenFiles = "ProcessOpenFiles"
+	// MetricProcessThreads holds the number of OS threads. If the current
+	// number cannot be retrieved, the number of threads created is stored.
+	MetricProcessThreads = "ProcessThreads"
 )
 
 // ProcessStartTime stores the time this process has started.
@@ -57,21 +91,37 @@ var Metric = (*Metrics)(nil)
 // Metrics is the container struct for runtime metrics that can be used with
 // the metrics server.
 type Metrics struct {
-	store      map[string]*int64
-	rates      map[string]*rate
-	storeGuard *sync.RWMutex
-	rateGuard  *sync.RWMutex
+	store        map[string]*int64
+	floats       map[string]*uint64
+	rates        map[string]*rate
+	vecs         map[string]*MetricVec
+	histograms   map[string]*Histogram
+	summaries    map[string]*Summary
+	infos        map[string]MetricInfo
+	persistent   map[string]bool
+	rejected     map[string]bool
+	collisions   map[string]bool
+	scheduler    *sampleScheduler
+	persistTask  *scheduledTask
+	persistPath  string
+	storeGuard   *sync.RWMutex
+	rateGuard    *sync.RWMutex
+	warnings     int32
+	systemGroups uint32
 }
 
 type rate struct {
 	metric     string
-	samples    tcontainer.Int64Slice
-	ticker     *time.Ticker
-	lastSample int64
-	value      int64
+	samples    tcontainer.Float64Slice
+	task       *scheduledTask
+	lastSample float64
+	value      uint64
 	index      uint64
 	numMedians int
 	relative   bool
+	isFloat    bool
+	interval   time.Duration
+	alpha      float64
 }
 
 func init() {
@@ -92,7 +142,15 @@ func EnableGlobalMetrics() {
 func NewMetrics() *Metrics {
 	return &Metrics{
 		store:      make(map[string]*int64),
+		floats:     make(map[string]*uint64),
 		rates:      make(map[string]*rate),
+		vecs:       make(map[string]*MetricVec),
+		histograms: make(map[string]*Histogram),
+		summaries:  make(map[string]*Summary),
+		infos:      make(map[string]MetricInfo),
+		persistent: make(map[string]bool),
+		rejected:   make(map[string]bool),
+		collisions: make(map[string]bool),
 		storeGuard: new(sync.RWMutex),
 		rateGuard:  new(sync.RWMutex),
 	}
@@ -101,37 +159,38 @@ func NewMetrics() *Metrics {
 // InitSystemMetrics Adds system metrics (memory, go routines, etc.) to this
 // metric storage. System metrics need to be updated manually by
 // calling UpdateSystemMetrics().
+// This is equivalent to calling InitSystemMetricGroups(SystemMetricsAll).
 func (met *Metrics) InitSystemMetrics() {
-	met.New(MetricProcessStart)
-	met.New(MetricGoRoutines)
-	met.New(MetricGoVersion)
-	met.New(MetricMemoryAllocated)
-	met.New(MetricMemoryNumObjects)
-	met.New(MetricMemoryGCEnabled)
-	met.Set(MetricProcessStart, ProcessStartTime.Unix())
-
-	version := runtime.Version()
-	if version[0] == 'g' && version[1] == 'o' {
-		parts := strings.Split(version[2:], ".")
-		numericVersion := make([]uint64, tmath.MaxI(3, len(parts)))
-		for i, p := range parts {
-			numericVersion[i], _ = strconv.ParseUint(p, 10, 64)
-		}
-
-		met.SetI(MetricGoVersion, int(numericVersion[0]*10000+numericVersion[1]*100+numericVersion[2]))
-	}
-
-	met.UpdateSystemMetrics()
+	met.InitSystemMetricGroups(SystemMetricsAll)
 }
 
-// Close stops the internal go routines used for e.g. sampling
+// Close stops the internal go routines used for e.g. sampling.
+// Rates are not updated anymore after Close has been called. Creating a new
+// rate after Close restarts sampling for all registered rates.
+// If persistence has been enabled, a final snapshot is written and
+// persistence is disabled. Errors during writing are logged to tlog.Error.
 func (met *Metrics) Close() {
-	for _, r := range met.rates {
-		r.ticker.Stop()
+	// Stop without holding the lock as running tasks require it
+	met.rateGuard.Lock()
+	scheduler := met.scheduler
+	persistPath := met.persistPath
+	met.persistPath = ""
+	met.persistTask = nil
+	met.rateGuard.Unlock()
+
+	if scheduler != nil {
+		scheduler.Stop()
+	}
+	if persistPath != "" {
+		met.saveSnapshotLogged(persistPath)
 	}
 }
 
-// New creates a new metric under the given name with a value of 0
+// New creates a new metric under the given name with a value of 0.
+// If the name is already used by a metric of another type, e.g. a float
+// metric, no metric is created and all writes using the integer functions
+// like Set or Add are ignored. A warning is written to tlog.Warning in this
+// case.
 func (met *Metrics) New(name string) {
 	met.new(name)
 }
@@ -147,13 +206,22 @@ func (met *Metrics) New(name string) {
 // build a median over the mean of all these groups.
 // The relative parameter defines if the samples are taking by storing the
 // current value (false) or the difference to the last sample (true).
+// The base metric may be an integer or a float metric. Rates of float
+// metrics are reported as float values. The interval must be positive.
+// All rates of a Metrics instance are sampled by a single go routine.
 func (met *Metrics) NewRate(baseMetric string, name string, interval time.Duration, numSamples uint8, numMedianSamples uint8, relative bool) error {
+	if interval <= 0 {
+		return fmt.Errorf("Rate %s requires a positive interval", name)
+	}
+
 	met.storeGuard.RLock()
-	if _, exists := met.store[baseMetric]; !exists {
-		met.storeGuard.RUnlock()
+	_, isInt := met.store[baseMetric]
+	_, isFloat := met.floats[baseMetric]
+	met.storeGuard.RUnlock()
+
+	if !isInt && !isFloat {
 		return fmt.Errorf("Metric %s is not registered", baseMetric)
 	}
-	met.storeGuard.RUnlock()
 
 	met.rateGuard.Lock()
 	defer met.rateGuard.Unlock()
@@ -168,104 +236,197 @@ func (met *Metrics) NewRate(baseMetric string, name string, interval time.Durati
 
 	newRate := &rate{
 		metric:     baseMetric,
-		samples:    make(tcontainer.Int64Slice, numSamples),
+		samples:    make(tcontainer.Float64Slice, numSamples),
 		numMedians: int(numMedianSamples),
 		lastSample: 0,
 		value:      0,
 		index:      0,
-		ticker:     time.NewTicker(interval),
+		interval:   interval,
 		relative:   relative,
+		isFloat:    isFloat,
 	}
 
+	if err := met.scheduleRate(newRate); err != nil {
+		return err
+	}
 	met.rates[name] = newRate
+	met.setDefaultInfo(name, MetricInfo{Kind: MetricKindRate})
 
-	go func() {
-		isRunning := true
-		for isRunning {
-			_, isRunning = <-newRate.ticker.C
-			met.updateRate(newRate)
+	return nil
+}
+
+// RemoveRate stops sampling the given rate and removes it along with its
+// metadata. The base metric is not affected. If the rate does not exist,
+// nothing happens.
+func (met *Metrics) RemoveRate(name string) {
+	met.rateGuard.Lock()
+	r, exists := met.rates[name]
+	if exists {
+		delete(met.rates, name)
+	}
+	scheduler := met.scheduler
+	met.rateGuard.Unlock()
+
+	if !exists {
+		return // ### return, unknown rate ###
+	}
+
+	if scheduler != nil {
+		scheduler.Remove(r.task)
+	}
+
+	met.storeGuard.Lock()
+	delete(met.infos, name)
+	met.storeGuard.Unlock()
+}
+
+// Remove removes the metric of the given name along with its metadata.
+// This works for integer and float metrics as well as for labeled metric
+// families, histograms and summaries. All rates based on this metric are
+// removed, too. If the metric does not exist, nothing happens.
+// Handles to a removed metric stay valid but are not reported anymore.
+func (met *Metrics) Remove(name string) {
+	met.storeGuard.Lock()
+	delete(met.store, name)
+	delete(met.floats, name)
+	delete(met.vecs, name)
+	delete(met.histograms, name)
+	delete(met.summaries, name)
+	delete(met.infos, name)
+	delete(met.persistent, name)
+	delete(met.rejected, name)
+	delete(met.collisions, name)
+	met.storeGuard.Unlock()
+
+	dependentRates := []string{}
+	met.rateGuard.RLock()
+	for rateName, r := range met.rates {
+		if r.metric == name {
+			dependentRates = append(dependentRates, rateName)
 		}
-	}()
+	}
+	met.rateGuard.RUnlock()
 
-	return nil
+	for _, rateName := range dependentRates {
+		met.RemoveRate(rateName)
+	}
+}
+
+// scheduleRate registers the given rate with the sampling scheduler.
+// The rateGuard has to be locked when calling this function.
+func (met *Metrics) scheduleRate(r *rate) error {
+	met.startScheduler(r)
+	task, err := met.scheduler.Add(r.interval, met.rateUpdater(r))
+	r.task = task
+	return err
+}
+
+// startScheduler creates the sampling scheduler if required. If sampling has
+// been stopped by Close, all rates except for the given one are registered
+// again. The rateGuard has to be locked when calling this function.
+func (met *Metrics) startScheduler(except *rate) {
+	if met.scheduler == nil {
+		met.scheduler = newSampleScheduler()
+	}
+	if !met.scheduler.IsRunning() {
+		// Restart sampling of rates dropped by Close. Registered rates have
+		// been validated already, so Add cannot fail.
+		for _, other := range met.rates {
+			if other != except {
+				other.task, _ = met.scheduler.Add(other.interval, met.rateUpdater(other))
+			}
+		}
+	}
+}
+
+func (met *Metrics) rateUpdater(r *rate) func() {
+	return func() {
+		met.updateRate(r)
+	}
 }
 
 // Set sets a given metric to a given value.
 func (met *Metrics) Set(name string, value int64) {
-	atomic.StoreInt64(met.get(name), value)
+	met.storeValue(name, value)
 }
 
 // SetI is Set for int values (conversion to int64)
 func (met *Metrics) SetI(name string, value int) {
-	atomic.StoreInt64(met.get(name), int64(value))
+	met.storeValue(name, int64(value))
 }
 
 // SetF is Set for float64 values (conversion to int64)
 func (met *Metrics) SetF(name string, value float64) {
 	rounded := math.Floor(value + 0.5)
-	atomic.StoreInt64(met.get(name), int64(rounded))
+	met.storeValue(name, int64(rounded))
 }
 
 // SetB is Set for boolean values (conversion to 0/1)
 func (met *Metrics) SetB(name string, value bool) {
 	if value {
-		atomic.StoreInt64(met.get(name), int64(1))
+		met.storeValue(name, int64(1))
 	} else {
-		atomic.StoreInt64(met.get(name), int64(0))
+		met.storeValue(name, int64(0))
 	}
 }
 
 // Inc adds 1 to a given metric.
 func (met *Metrics) Inc(name string) {
-	atomic.AddInt64(met.get(name), 1)
+	met.addValue(name, 1)
 }
 
 // Dec subtracts 1 from a given metric.
 func (met *Metrics) Dec(name string) {
-	atomic.AddInt64(met.get(name), -1)
+	met.addValue(name, -1)
 }
 
 // Add adds a number to a given metric.
 func (met *Metrics) Add(name string, value int64) {
-	atomic.AddInt64(met.get(name), value)
+	met.addValue(name, value)
 }
 
 // AddI is Add for int values (conversion to int64)
 func (met *Metrics) AddI(name string, value int) {
-	atomic.AddInt64(met.get(name), int64(value))
+	met.addValue(name, int64(value))
 }
 
 // AddF is Add for float64 values (conversion to int64)
 func (met *Metrics) AddF(name string, value float64) {
 	rounded := math.Floor(value + 0.5)
-	atomic.AddInt64(met.get(name), int64(rounded))
+	met.addValue(name, int64(rounded))
 }
 
 // Sub subtracts a number to a given metric.
 func (met *Metrics) Sub(name string, value int64) {
-	atomic.AddInt64(met.get(name), -value)
+	met.addValue(name, -value)
 }
 
 // SubI is SubI for int values (conversion to int64)
 func (met *Metrics) SubI(name string, value int) {
-	atomic.AddInt64(met.get(name), int64(-value))
+	met.addValue(name, int64(-value))
 }
 
 // SubF is Sub for float64 values (conversion to int64)
 func (met *Metrics) SubF(name string, value float64) {
 	rounded := math.Floor(value + 0.5)
-	atomic.AddInt64(met.get(name), int64(-rounded))
+	met.addValue(name, int64(-rounded))
 }
 
-// Get returns the value of a given metric or rate.
+// Get returns the value of a given metric, float metric or rate. Float
+// metrics are rounded to the nearest integer.
 // If the value does not exists error is non-nil and the returned value is 0.
 func (met *Metrics) Get(name string) (int64, error) {
 	if metric := met.tryGetMetric(name); metric != nil {
 		return atomic.LoadInt64(metric), nil
 	}
 
+	if metric := met.tryGetFloat(name); metric != nil {
+		value := math.Float64frombits(atomic.LoadUint64(metric))
+		return int64(math.Floor(value + 0.5)), nil
+	}
+
 	if rate := met.tryGetRate(name); rate != nil {
-		return *rate, nil
+		return int64(rate.get()), nil
 	}
 
 	// Neither rate nor metric found
@@ -273,22 +434,64 @@ func (met *Metrics) Get(name string) (int64, error) {
 }
 
 // Dump creates a JSON string from all stored metrics.
+// Labeled metrics are stored using keys of the form name{label="value"}.
+// Histograms and summaries are stored as objects containing count, sum and
+// their buckets or quantiles respectively.
 func (met *Metrics) Dump() ([]byte, error) {
-	snapshot := make(map[string]int64)
+	return json.Marshal(met.snapshot(nil))
+}
+
+// DumpFiltered works like Dump but only contains metrics whose name is
+// accepted by the given filter. Labeled metrics are filtered by the name of
+// their metric family.
+func (met *Metrics) DumpFiltered(filter MetricFilter) ([]byte, error) {
+	return json.Marshal(met.snapshot(filter))
+}
+
+// snapshot returns the current value of all metrics accepted by filter as
+// stored by Dump. A nil filter accepts all metrics.
+func (met *Metrics) snapshot(filter MetricFilter) map[string]interface{} {
+	snapshot := make(map[string]interface{})
 
 	met.storeGuard.RLock()
 	for key, value := range met.store {
-		snapshot[key] = atomic.LoadInt64(value)
+		if filter.accepts(key) {
+			snapshot[key] = atomic.LoadInt64(value)
+		}
+	}
+	for key, value := range met.floats {
+		if filter.accepts(key) {
+			snapshot[key] = math.Float64frombits(atomic.LoadUint64(value))
+		}
+	}
+	for key, vec := range met.vecs {
+		if filter.accepts(key) {
+			for _, sample := range vec.snapshot() {
+				snapshot[vec.formatKey(sample.labelValues)] = sample.value
+			}
+		}
+	}
+	for key, hist := range met.histograms {
+		if filter.accepts(key) {
+			snapshot[key] = hist.Snapshot().dumpValue()
+		}
+	}
+	for key, summary := range met.summaries {
+		if filter.accepts(key) {
+			snapshot[key] = summary.Snapshot().dumpValue()
+		}
 	}
 	met.storeGuard.RUnlock()
 
 	met.rateGuard.RLock()
 	for key, rate := range met.rates {
-		snapshot[key] = rate.value
+		if filter.accepts(key) {
+			snapshot[key] = rate.dumpValue()
+		}
 	}
 	met.rateGuard.RUnlock()
 
-	return json.Marshal(snapshot)
+	return snapshot
 }
 
 // ResetMetrics resets all registered key values to 0 expect for system Metrics.
@@ -303,21 +506,32 @@ func (met *Metrics) ResetMetrics() {
 			*met.store[key] = 0
 		}
 	}
+	for _, value := range met.floats {
+		atomic.StoreUint64(value, 0)
+	}
+	for _, vec := range met.vecs {
+		vec.reset()
+	}
+	for _, hist := range met.histograms {
+		hist.reset()
+	}
+	for _, summary := range met.summaries {
+		summary.reset()
+	}
 	met.storeGuard.Unlock()
 
 	met.rateGuard.Lock()
 	for _, rate := range met.rates {
-		rate.lastSample = 0
-		rate.value = 0
-		rate.index = 0
-		rate.samples.Set(0)
+		rate.reset()
 	}
 	met.rateGuard.Unlock()
 }
 
 // FetchAndReset resets all of the given keys to 0 and returns the
 // value before the reset as array. If a given metric does not exist
-// it is ignored. This locks all writes in the process.
+// it is ignored. Float metrics are ignored, too.
+// This locks all writes in the process. Use NewCursor to read changes
+// without resetting the metrics.
 func (met *Metrics) FetchAndReset(keys ...string) map[string]int64 {
 	state := make(map[string]int64)
 
@@ -333,10 +547,7 @@ func (met *Metrics) FetchAndReset(keys ...string) map[string]int64 {
 	met.rateGuard.Lock()
 	for _, key := range keys {
 		if rate, exists := met.rates[key]; exists {
-			rate.lastSample = 0
-			rate.value = 0
-			rate.index = 0
-			rate.samples.Set(0)
+			rate.reset()
 		}
 	}
 	met.rateGuard.Unlock()
@@ -344,25 +555,21 @@ func (met *Metrics) FetchAndReset(keys ...string) map[string]int64 {
 	return state
 }
 
-// UpdateSystemMetrics updates all default or system based metrics like memory
-// consumption and number of go routines. This function is not called
-// automatically.
-func (met *Metrics) UpdateSystemMetrics() {
-	stats := new(runtime.MemStats)
-	runtime.ReadMemStats(stats)
-
-	met.SetI(MetricGoRoutines, runtime.NumGoroutine())
-	met.Set(MetricMemoryAllocated, int64(stats.Alloc))
-	met.SetB(MetricMemoryGCEnabled, stats.EnableGC)
-	met.Set(MetricMemoryNumObjects, int64(stats.HeapObjects))
-}
-
 func (met *Metrics) updateRate(r *rate) {
 	met.rateGuard.RLock()
 	defer met.rateGuard.RUnlock()
 
 	// Read current values in a snapshot to avoid deadlocks
-	sample := atomic.LoadInt64(met.get(r.metric))
+	sample, exists := met.sample(r.metric)
+	if !exists {
+		return // ### return, base metric has been removed ###
+	}
+
+	if r.alpha > 0 {
+		r.updateEWMA(sample)
+		return // ### return, EWMA does not use samples ###
+	}
+
 	idx := r.index % uint64(len(r.samples))
 	r.index++
 
@@ -374,52 +581,171 @@ func (met *Metrics) updateRate(r *rate) {
 		r.samples[idx] = sample
 	}
 
-	numSamples := int64(tmath.MinUint64(idx+1, uint64(len(r.samples))))
+	numSamples := int(tmath.MinUint64(idx+1, uint64(len(r.samples))))
 
 	// Build value
 	switch {
 	case r.numMedians == 1:
 		// Mean of all values
-		total := int64(0)
+		total := float64(0)
 		for _, s := range r.samples[:numSamples] {
 			total += s
 		}
-		r.value = total / numSamples
+		r.set(total / float64(numSamples))
 
-	case r.numMedians == 0 || numSamples <= int64(r.numMedians):
+	case r.numMedians == 0 || numSamples <= r.numMedians:
 		// Median of all values
-		values := make(tcontainer.Int64Slice, numSamples)
+		values := make(tcontainer.Float64Slice, numSamples)
 		copy(values, r.samples[:numSamples])
 		values.Sort()
-		r.value = values[numSamples/2]
+		r.set(values[numSamples/2])
 
 	default:
 		// Median of means
-		blockSize := float32(numSamples) / float32(r.numMedians)
-		blocks := make(tcontainer.Float32Slice, r.numMedians)
+		blockSize := float64(numSamples) / float64(r.numMedians)
+		blocks := make(tcontainer.Float64Slice, r.numMedians)
 
 		for i, s := range r.samples[:numSamples] {
-			blockIdx := int(float32(i) / blockSize)
-			blocks[blockIdx] += float32(s)
+			blockIdx := int(float64(i) / blockSize)
+			blocks[blockIdx] += s
 		}
 
 		blocks.Sort()
-		r.value = int64(blocks[r.numMedians/2] / blockSize)
+		r.set(blocks[r.numMedians/2] / blockSize)
+	}
+}
+
+// sample returns the current value of an integer or float metric. If the
+// metric does not exist, false is returned.
+func (met *Metrics) sample(name string) (float64, bool) {
+	if metric := met.tryGetFloat(name); metric != nil {
+		return math.Float64frombits(atomic.LoadUint64(metric)), true
+	}
+	if metric := met.tryGetMetric(name); metric != nil {
+		return float64(atomic.LoadInt64(metric)), true
+	}
+	return 0, false
+}
+
+func (r *rate) get() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&r.value))
+}
+
+func (r *rate) set(value float64) {
+	atomic.StoreUint64(&r.value, math.Float64bits(value))
+}
+
+// dumpValue returns the value of the rate as float64 if the rate is based
+// on a float metric. Otherwise the value is returned as int64.
+func (r *rate) dumpValue() interface{} {
+	if r.isFloat {
+		return r.get()
+	}
+	return int64(r.get())
+}
+
+func (r *rate) reset() {
+	r.lastSample = 0
+	r.index = 0
+	r.samples.Set(0)
+	r.set(0)
+}
+
+// goVersion returns the go version as Major*10000+Minor*100+Patch
+func goVersion() int {
+	version := runtime.Version()
+	if version[0] != 'g' || version[1] != 'o' {
+		return 0 // ### return, development version ###
+	}
+
+	parts := strings.Split(version[2:], ".")
+	numericVersion := make([]uint64, tmath.MaxI(3, len(parts)))
+	for i, p := range parts {
+		numericVersion[i], _ = strconv.ParseUint(p, 10, 64)
+	}
+
+	return int(numericVersion[0]*10000 + numericVersion[1]*100 + numericVersion[2])
+}
+
+// isRegistered returns true if a metric, labeled metric family, histogram or
+// summary with the given name exists.
+func (met *Metrics) isRegistered(name string) bool {
+	met.storeGuard.RLock()
+	defer met.storeGuard.RUnlock()
+	return met.checkUnused(name) != nil
+}
+
+// checkUnused returns an error if the given name is already used by a
+// metric of any type. The storeGuard has to be locked when calling this
+// function.
+func (met *Metrics) checkUnused(name string) error {
+	kind := ""
+	if _, exists := met.store[name]; exists {
+		kind = "integer metric"
+	} else if _, exists := met.floats[name]; exists {
+		kind = "float metric"
+	} else if _, exists := met.vecs[name]; exists {
+		kind = "labeled metric family"
+	} else if _, exists := met.histograms[name]; exists {
+		kind = "histogram"
+	} else if _, exists := met.summaries[name]; exists {
+		kind = "summary"
+	}
+
+	if kind != "" {
+		return fmt.Errorf("Metric %s is already registered as %s", name, kind)
 	}
+	return nil
 }
 
 func (met *Metrics) new(name string) *int64 {
 	met.storeGuard.Lock()
+	defer met.storeGuard.Unlock()
+
 	value, exists := met.store[name]
-	if !exists {
-		value = new(int64)
-		met.store[name] = value
+	if exists {
+		return value // ### return, exists ###
+	}
+
+	value = new(int64)
+	if err := met.checkUnused(name); err != nil {
+		met.reject(name, err)
+		return value // ### return, detached value ###
 	}
-	met.storeGuard.Unlock()
 
+	met.store[name] = value
 	return value
 }
 
+// reject logs that a metric of the given name could not be created. Each
+// name is logged only once. The storeGuard has to be locked when calling
+// this function.
+func (met *Metrics) reject(name string, err error) {
+	if !met.rejected[name] {
+		met.rejected[name] = true
+		tlog.Warning.Printf("%s, writes of another type are ignored", err)
+	}
+}
+
+func (met *Metrics) storeValue(name string, value int64) {
+	metric := met.get(name)
+	if atomic.LoadInt32(&met.warnings) == 0 {
+		atomic.StoreInt64(metric, value)
+		return // ### return, no checks required ###
+	}
+
+	if old := atomic.SwapInt64(metric, value); value < old {
+		met.warnDecrease(name, value-old)
+	}
+}
+
+func (met *Metrics) addValue(name string, value int64) {
+	atomic.AddInt64(met.get(name), value)
+	if value < 0 && atomic.LoadInt32(&met.warnings) != 0 {
+		met.warnDecrease(name, value)
+	}
+}
+
 func (met *Metrics) get(name string) *int64 {
 	met.storeGuard.RLock()
 	v, exists := met.store[name]
@@ -442,13 +768,13 @@ func (met *Metrics) tryGetMetric(name string) *int64 {
 	return nil
 }
 
-func (met *Metrics) tryGetRate(name string) *int64 {
+func (met *Metrics) tryGetRate(name string) *rate {
 	met.rateGuard.RLock()
 	r, exists := met.rates[name]
 	met.rateGuard.RUnlock()
 
 	if exists {
-		return &r.value // ### return, exists ###
+		return r // ### return, exists ###
 	}
 	return nil
 }
@@ -24,7 +24,15 @@ import (
 func getMockMetric() *Metrics {
 	return &Metrics{
 		store:      make(map[string]*int64),
+		floats:     make(map[string]*uint64),
 		rates:      make(map[string]*rate),
+		vecs:       make(map[string]*MetricVec),
+		histograms: make(map[string]*Histogram),
+		summaries:  make(map[string]*Summary),
+		infos:      make(map[string]MetricInfo),
+		persistent: make(map[string]bool),
+		rejected:   make(map[string]bool),
+		collisions: make(map[string]bool),
 		storeGuard: new(sync.RWMutex),
 		rateGuard:  new(sync.RWMutex),
 	}
@@ -38,6 +46,11 @@ func TestRateAbsolute(t *testing.T) {
 	mockMetric.New("base")
 	err := mockMetric.NewRate("invalid", "mean", time.Hour, 10, 0, false)
 	expect.NotNil(err)
+	err = mockMetric.NewRate("base", "mean", 0, 10, 0, false)
+	expect.NotNil(err)
+	err = mockMetric.NewRate("base", "mean", -time.Second, 10, 0, false)
+	expect.NotNil(err)
+	expect.MapNotSet(mockMetric.rates, "mean")
 
 	err = mockMetric.NewRate("base", "median", time.Hour, 10, 0, false)
 	expect.NoError(err)
@@ -166,6 +179,68 @@ func TestRateIncomplete(t *testing.T) {
 	expect.Equal(int64(2), value)
 }
 
+func numScheduledTasks(met *Metrics) int {
+	met.scheduler.guard.Lock()
+	defer met.scheduler.guard.Unlock()
+	return len(met.scheduler.tasks)
+}
+
+// schedulerStopped returns true if the scheduler is not running and the go
+// routine of its last run has ended.
+func schedulerStopped(met *Metrics) bool {
+	met.scheduler.guard.Lock()
+	running, done := met.scheduler.running, met.scheduler.done
+	met.scheduler.guard.Unlock()
+
+	select {
+	case <-done:
+		return !running
+	default:
+		return false
+	}
+}
+
+func TestRateScheduling(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	mockMetric.New("base")
+	mockMetric.Set("base", 5)
+	for _, name := range []string{"r1", "r2", "r3", "r4"} {
+		err := mockMetric.NewRate("base", name, 10*time.Millisecond, 10, 0, false)
+		expect.NoError(err)
+	}
+	expect.NoError(mockMetric.NewEWMA("base", "ewma", time.Minute))
+
+	// All rates share one scheduler go routine
+	expect.True(mockMetric.scheduler.IsRunning())
+	expect.Equal(5, numScheduledTasks(mockMetric))
+
+	expect.NonBlocking(time.Second, func() {
+		for {
+			if value, _ := mockMetric.Get("r4"); value == 5 {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	mockMetric.RemoveRate("r4")
+	_, err := mockMetric.Get("r4")
+	expect.NotNil(err)
+	expect.Equal(4, numScheduledTasks(mockMetric))
+
+	mockMetric.Close()
+	expect.True(schedulerStopped(mockMetric))
+
+	// Creating a new rate restarts sampling of existing rates
+	expect.NoError(mockMetric.NewRate("base", "r5", 10*time.Millisecond, 10, 0, false))
+	expect.Equal(5, numScheduledTasks(mockMetric))
+	expect.True(mockMetric.scheduler.IsRunning())
+	mockMetric.Close()
+	expect.True(schedulerStopped(mockMetric))
+}
+
 func TestMetricsSet(t *testing.T) {
 	expect := ttesting.NewExpect(t)
 	mockMetric := getMockMetric()
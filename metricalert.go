@@ -0,0 +1,236 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// MetricAlertState defines an enumeration for the state of a MetricAlert
+type MetricAlertState int32
+
+const (
+	// MetricAlertNormal is used if the threshold has not been crossed or the
+	// metric has recovered.
+	MetricAlertNormal = MetricAlertState(iota)
+	// MetricAlertPending is used if the threshold has been crossed but the
+	// metric did not stay beyond it for the required duration yet.
+	MetricAlertPending = MetricAlertState(iota)
+	// MetricAlertFiring is used if the metric stayed beyond the threshold
+	// for the required duration.
+	MetricAlertFiring = MetricAlertState(iota)
+)
+
+// MetricAlert watches a metric or rate and calls a callback whenever the
+// watched value crosses a threshold, stays beyond it for a given duration
+// or returns to normal.
+// Alerts use a hysteresis: once the threshold has been crossed, the alert
+// only returns to normal after the value has crossed the recovery value.
+type MetricAlert struct {
+	metrics   *Metrics
+	metric    string
+	threshold float64
+	recovery  float64
+	below     bool
+	sustain   time.Duration
+	callback  func(MetricAlertEvent)
+	task      *scheduledTask
+	since     time.Time
+	state     int32
+	value     uint64
+}
+
+// MetricAlertEvent is passed to the callback of a MetricAlert whenever the
+// state of the alert changes.
+type MetricAlertEvent struct {
+	Metric   string
+	State    MetricAlertState
+	Previous MetricAlertState
+	Value    float64
+	// Since holds the time when the threshold has been crossed. For events
+	// returning to normal this is the start of the alert that ended.
+	Since time.Time
+}
+
+// String returns the lowercase name of the alert state.
+func (state MetricAlertState) String() string {
+	switch state {
+	case MetricAlertPending:
+		return "pending"
+	case MetricAlertFiring:
+		return "firing"
+	default:
+		return "normal"
+	}
+}
+
+// AlertAbove creates an alert for the given metric or rate. The alert
+// becomes pending when the value reaches threshold. It starts firing once
+// the value has not dropped below recovery for at least sustain and is at or
+// above threshold. A sustain of 0 fires immediately. The alert returns to
+// normal when the value drops below recovery, which must not be greater
+// than threshold.
+// The value is checked in the given interval by the sampling go routine,
+// i.e. the callback should not block. Alerts are not checked anymore after
+// Close has been called.
+func (met *Metrics) AlertAbove(name string, threshold float64, recovery float64, sustain time.Duration, interval time.Duration, callback func(MetricAlertEvent)) (*MetricAlert, error) {
+	if recovery > threshold {
+		return nil, fmt.Errorf("Alert for %s requires a recovery value not greater than %v", name, threshold)
+	}
+	return met.newAlert(name, threshold, recovery, false, sustain, interval, callback)
+}
+
+// AlertBelow works like AlertAbove but becomes pending when the value drops
+// to or below threshold. The alert returns to normal when the value rises
+// above recovery, which must not be less than threshold.
+func (met *Metrics) AlertBelow(name string, threshold float64, recovery float64, sustain time.Duration, interval time.Duration, callback func(MetricAlertEvent)) (*MetricAlert, error) {
+	if recovery < threshold {
+		return nil, fmt.Errorf("Alert for %s requires a recovery value not less than %v", name, threshold)
+	}
+	return met.newAlert(name, threshold, recovery, true, sustain, interval, callback)
+}
+
+func (met *Metrics) newAlert(name string, threshold float64, recovery float64, below bool, sustain time.Duration, interval time.Duration, callback func(MetricAlertEvent)) (*MetricAlert, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("Alert for %s requires a positive interval", name)
+	}
+	if _, err := met.GetFloat(name); err != nil {
+		return nil, err
+	}
+
+	alert := &MetricAlert{
+		metrics:   met,
+		metric:    name,
+		threshold: threshold,
+		recovery:  recovery,
+		below:     below,
+		sustain:   sustain,
+		callback:  callback,
+		value:     math.Float64bits(math.NaN()),
+	}
+
+	met.rateGuard.Lock()
+	defer met.rateGuard.Unlock()
+
+	met.startScheduler(nil)
+	task, err := met.scheduler.Add(interval, func() {
+		alert.check(time.Now())
+	})
+	if err != nil {
+		return nil, err
+	}
+	alert.task = task
+
+	return alert, nil
+}
+
+// Stop stops checking the alert. The callback is not called anymore after
+// this function returns, unless it is currently running.
+func (alert *MetricAlert) Stop() {
+	met := alert.metrics
+	met.rateGuard.RLock()
+	scheduler := met.scheduler
+	met.rateGuard.RUnlock()
+
+	if scheduler != nil {
+		scheduler.Remove(alert.task)
+	}
+}
+
+// State returns the current state of the alert.
+func (alert *MetricAlert) State() MetricAlertState {
+	return MetricAlertState(atomic.LoadInt32(&alert.state))
+}
+
+// Value returns the value seen by the last check. If the alert has not been
+// checked yet, NaN is returned.
+func (alert *MetricAlert) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&alert.value))
+}
+
+// HealthCheck returns http.StatusServiceUnavailable if the alert is firing
+// and http.StatusOK otherwise, along with a short description. The function
+// signature matches thealthcheck.CallbackFunc so that alerts can be used as
+// health check endpoints, e.g.
+//
+//	thealthcheck.AddEndpoint("/queue", alert.HealthCheck)
+func (alert *MetricAlert) HealthCheck() (code int, body string) {
+	state := alert.State()
+	body = fmt.Sprintf("%s is %s (value %s, threshold %s)", alert.metric, state, formatFloat(alert.Value()), formatFloat(alert.threshold))
+
+	if state == MetricAlertFiring {
+		return http.StatusServiceUnavailable, body
+	}
+	return http.StatusOK, body
+}
+
+// check evaluates the alert at the given time. This function must not be
+// called concurrently.
+func (alert *MetricAlert) check(now time.Time) {
+	value, err := alert.metrics.GetFloat(alert.metric)
+	if err != nil {
+		return // ### return, metric has been removed ###
+	}
+	atomic.StoreUint64(&alert.value, math.Float64bits(value))
+
+	previous := alert.State()
+	state := previous
+
+	switch {
+	case alert.exceeds(value):
+		if state == MetricAlertNormal {
+			state = MetricAlertPending
+			alert.since = now
+		}
+		if state == MetricAlertPending && now.Sub(alert.since) >= alert.sustain {
+			state = MetricAlertFiring
+		}
+	case alert.recovered(value):
+		state = MetricAlertNormal
+	}
+
+	if state == previous {
+		return // ### return, no change ###
+	}
+
+	atomic.StoreInt32(&alert.state, int32(state))
+	if alert.callback != nil {
+		alert.callback(MetricAlertEvent{
+			Metric:   alert.metric,
+			State:    state,
+			Previous: previous,
+			Value:    value,
+			Since:    alert.since,
+		})
+	}
+}
+
+func (alert *MetricAlert) exceeds(value float64) bool {
+	if alert.below {
+		return value <= alert.threshold
+	}
+	return value >= alert.threshold
+}
+
+func (alert *MetricAlert) recovered(value float64) bool {
+	if alert.below {
+		return value > alert.recovery
+	}
+	return value < alert.recovery
+}
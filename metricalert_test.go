@@ -0,0 +1,123 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestMetricAlertAbove(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+	defer mockMetric.Close()
+
+	mockMetric.New("queue")
+	events := []MetricAlertEvent{}
+	alert, err := mockMetric.AlertAbove("queue", 100, 80, 10*time.Second, time.Hour, func(event MetricAlertEvent) {
+		events = append(events, event)
+	})
+	expect.NoError(err)
+	expect.Equal(MetricAlertNormal, alert.State())
+
+	start := time.Now()
+	check := func(value int64, offset time.Duration) {
+		mockMetric.Set("queue", value)
+		alert.check(start.Add(offset))
+	}
+
+	check(50, 0)
+	expect.Equal(0, len(events))
+
+	check(100, time.Second)
+	expect.Equal(MetricAlertPending, alert.State())
+	expect.Equal(1, len(events))
+
+	// Values between recovery and threshold keep the alert active
+	check(90, 5*time.Second)
+	check(120, 11*time.Second)
+	expect.Equal(MetricAlertFiring, alert.State())
+	expect.Equal(2, len(events))
+	expect.Equal(MetricAlertPending, events[1].Previous)
+	expect.Equal(float64(120), events[1].Value)
+	expect.Equal(start.Add(time.Second), events[1].Since)
+
+	code, _ := alert.HealthCheck()
+	expect.Equal(http.StatusServiceUnavailable, code)
+
+	check(85, 12*time.Second)
+	expect.Equal(MetricAlertFiring, alert.State())
+
+	check(79, 13*time.Second)
+	expect.Equal(MetricAlertNormal, alert.State())
+	expect.Equal(3, len(events))
+	expect.Equal(MetricAlertFiring, events[2].Previous)
+
+	code, body := alert.HealthCheck()
+	expect.Equal(http.StatusOK, code)
+	expect.Equal("queue is normal (value 79, threshold 100)", body)
+
+	// Recovering before sustain has passed does not fire
+	check(150, 20*time.Second)
+	check(10, 21*time.Second)
+	expect.Equal(5, len(events))
+	expect.Equal(MetricAlertPending, events[4].Previous)
+	expect.Equal(MetricAlertNormal, events[4].State)
+}
+
+func TestMetricAlertBelow(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+	defer mockMetric.Close()
+
+	mockMetric.NewFloat("free")
+	mockMetric.SetFloat("free", 0.5)
+
+	_, err := mockMetric.AlertBelow("free", 0.1, 0.05, 0, time.Second, nil)
+	expect.NotNil(err)
+	_, err = mockMetric.AlertBelow("missing", 0.1, 0.2, 0, time.Second, nil)
+	expect.NotNil(err)
+
+	fired := make(chan MetricAlertEvent, 10)
+	alert, err := mockMetric.AlertBelow("free", 0.1, 0.2, 0, 5*time.Millisecond, func(event MetricAlertEvent) {
+		fired <- event
+	})
+	expect.NoError(err)
+
+	mockMetric.SetFloat("free", 0.05)
+	expect.NonBlocking(time.Second, func() {
+		event := <-fired
+		expect.Equal(MetricAlertFiring, event.State)
+		expect.Equal(MetricAlertNormal, event.Previous)
+	})
+
+	mockMetric.SetFloat("free", 0.15)
+	time.Sleep(20 * time.Millisecond)
+	expect.Equal(MetricAlertFiring, alert.State())
+
+	mockMetric.SetFloat("free", 0.25)
+	expect.NonBlocking(time.Second, func() {
+		event := <-fired
+		expect.Equal(MetricAlertNormal, event.State)
+	})
+
+	alert.Stop()
+	mockMetric.SetFloat("free", 0)
+	time.Sleep(20 * time.Millisecond)
+	expect.Equal(MetricAlertNormal, alert.State())
+}
@@ -0,0 +1,136 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// MetricCursor reads the change of integer metrics since its last read
+// without modifying the metrics. Each cursor keeps its own state, so that
+// multiple readers can use the same Metrics store without interfering with
+// each other. This is the non-destructive alternative to FetchAndReset.
+type MetricCursor struct {
+	metrics *Metrics
+	last    map[string]int64
+	guard   *sync.Mutex
+}
+
+type cursorSample struct {
+	value     int64
+	isCounter bool
+}
+
+// NewCursor creates a new cursor on this metrics store. The first read
+// returns the change since the cursor has been created. Metrics created
+// after the cursor start at 0.
+func (met *Metrics) NewCursor() *MetricCursor {
+	cursor := &MetricCursor{
+		metrics: met,
+		last:    make(map[string]int64),
+		guard:   new(sync.Mutex),
+	}
+
+	for key, sample := range met.cursorSamples(nil, nil) {
+		cursor.last[key] = sample.value
+	}
+	return cursor
+}
+
+// Fetch returns the change of the given integer metrics since the last read
+// of this cursor. If a given metric does not exist it is ignored.
+// Deltas of metrics registered as MetricKindCounter are never negative. If
+// such a metric has been decreased, e.g. by ResetMetrics, it is treated as
+// reset and its current value is returned. Deltas of all other metrics may
+// be negative.
+// If no keys are given, this function behaves like FetchFiltered(nil).
+func (cursor *MetricCursor) Fetch(keys ...string) map[string]int64 {
+	if len(keys) == 0 {
+		return cursor.FetchFiltered(nil) // ### return, fetch all ###
+	}
+	return cursor.delta(cursor.metrics.cursorSamples(keys, nil), false)
+}
+
+// FetchFiltered works like Fetch but returns the change of all integer
+// metrics and labeled metrics accepted by the given filter. Labeled metrics
+// use the same names as Dump. A nil filter accepts all metrics.
+// Metrics that have been removed are forgotten by the cursor.
+func (cursor *MetricCursor) FetchFiltered(filter MetricFilter) map[string]int64 {
+	return cursor.delta(cursor.metrics.cursorSamples(nil, filter), filter == nil)
+}
+
+// delta calculates the changes to the given samples and stores the samples
+// as new state of the cursor. If forget is true, all keys not in samples
+// are removed from the cursor.
+func (cursor *MetricCursor) delta(samples map[string]cursorSample, forget bool) map[string]int64 {
+	deltas := make(map[string]int64, len(samples))
+
+	cursor.guard.Lock()
+	defer cursor.guard.Unlock()
+
+	for key, sample := range samples {
+		last := cursor.last[key]
+		if sample.isCounter && sample.value < last {
+			last = 0
+		}
+		deltas[key] = sample.value - last
+		cursor.last[key] = sample.value
+	}
+
+	if forget {
+		for key := range cursor.last {
+			if _, exists := samples[key]; !exists {
+				delete(cursor.last, key)
+			}
+		}
+	}
+
+	return deltas
+}
+
+// cursorSamples returns the current value of the given integer metrics or,
+// if no keys are given, of all integer and labeled metrics accepted by
+// filter.
+func (met *Metrics) cursorSamples(keys []string, filter MetricFilter) map[string]cursorSample {
+	samples := make(map[string]cursorSample)
+
+	met.storeGuard.RLock()
+	defer met.storeGuard.RUnlock()
+
+	if len(keys) > 0 {
+		for _, key := range keys {
+			if value, exists := met.store[key]; exists {
+				samples[key] = cursorSample{atomic.LoadInt64(value), met.infos[key].Kind == MetricKindCounter}
+			}
+		}
+		return samples // ### return, keys given ###
+	}
+
+	for key, value := range met.store {
+		if filter.accepts(key) {
+			samples[key] = cursorSample{atomic.LoadInt64(value), met.infos[key].Kind == MetricKindCounter}
+		}
+	}
+	for key, vec := range met.vecs {
+		if filter.accepts(key) {
+			isCounter := met.infos[key].Kind == MetricKindCounter
+			for _, sample := range vec.snapshot() {
+				samples[vec.formatKey(sample.labelValues)] = cursorSample{sample.value, isCounter}
+			}
+		}
+	}
+	return samples
+}
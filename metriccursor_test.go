@@ -0,0 +1,95 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"testing"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestMetricCursor(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	mockMetric.Set("before", 10)
+	first := mockMetric.NewCursor()
+
+	mockMetric.Add("before", 5)
+	mockMetric.Set("after", 3)
+	second := mockMetric.NewCursor()
+
+	deltas := first.Fetch("before", "after", "unknown")
+	expect.Equal(2, len(deltas))
+	expect.MapEqual(deltas, "before", int64(5))
+	expect.MapEqual(deltas, "after", int64(3))
+
+	// Reading through one cursor does not affect other readers
+	deltas = first.Fetch("before", "after")
+	expect.MapEqual(deltas, "before", int64(0))
+	expect.MapEqual(deltas, "after", int64(0))
+
+	mockMetric.Inc("before")
+	deltas = second.Fetch()
+	expect.MapEqual(deltas, "before", int64(1))
+	expect.MapEqual(deltas, "after", int64(0))
+
+	value, err := mockMetric.Get("before")
+	expect.NoError(err)
+	expect.Equal(int64(16), value)
+
+	// Gauges may report negative deltas, counters report resets
+	mockMetric.Counter("before")
+	mockMetric.Sub("after", 2)
+	mockMetric.Set("before", 4)
+	deltas = first.Fetch("before", "after")
+	expect.MapEqual(deltas, "before", int64(4))
+	expect.MapEqual(deltas, "after", int64(-2))
+}
+
+func TestMetricCursorFiltered(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+	cursor := mockMetric.NewCursor()
+
+	mockMetric.New("consumer.messages")
+	mockMetric.Set("producer.messages", 2)
+	mockMetric.NewFloat("consumer.seconds")
+	vec, err := mockMetric.NewVec("consumer.errors", 0, "code")
+	expect.NoError(err)
+	handle, err := vec.WithLabels("500")
+	expect.NoError(err)
+	handle.Add(7)
+
+	deltas := cursor.FetchFiltered(NewPrefixFilter("consumer."))
+	expect.Equal(2, len(deltas))
+	expect.MapEqual(deltas, "consumer.messages", int64(0))
+	expect.MapEqual(deltas, "consumer.errors{code=\"500\"}", int64(7))
+
+	handle.Inc()
+	deltas = cursor.FetchFiltered(nil)
+	expect.Equal(3, len(deltas))
+	expect.MapEqual(deltas, "consumer.errors{code=\"500\"}", int64(1))
+	expect.MapEqual(deltas, "producer.messages", int64(2))
+
+	// Removed metrics are forgotten
+	mockMetric.Remove("producer.messages")
+	cursor.FetchFiltered(nil)
+	expect.Equal(2, len(cursor.last))
+
+	mockMetric.Set("producer.messages", 1)
+	deltas = cursor.Fetch("producer.messages")
+	expect.MapEqual(deltas, "producer.messages", int64(1))
+}
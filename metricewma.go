@@ -0,0 +1,106 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// EWMASampleInterval is the interval used to sample the base metric of
+// rates created by NewEWMA.
+const EWMASampleInterval = 5 * time.Second
+
+// NewEWMA creates a new rate based on an exponentially weighted moving
+// average. The base metric is expected to be a counter. Every
+// EWMASampleInterval the increase of the base metric per second is sampled
+// and added to the average. The window defines the time after which a sample
+// has lost ~63% of its weight, similar to the Unix load average.
+func (met *Metrics) NewEWMA(baseMetric string, name string, window time.Duration) error {
+	if window < EWMASampleInterval {
+		return fmt.Errorf("EWMA window of %s must be at least %s", name, EWMASampleInterval)
+	}
+
+	met.storeGuard.RLock()
+	_, isInt := met.store[baseMetric]
+	_, isFloat := met.floats[baseMetric]
+	met.storeGuard.RUnlock()
+
+	if !isInt && !isFloat {
+		return fmt.Errorf("Metric %s is not registered", baseMetric)
+	}
+
+	met.rateGuard.Lock()
+	defer met.rateGuard.Unlock()
+
+	if _, exists := met.rates[name]; exists {
+		return fmt.Errorf("Rate %s is already registered", name)
+	}
+
+	newRate := &rate{
+		metric:   baseMetric,
+		interval: EWMASampleInterval,
+		alpha:    1 - math.Exp(-EWMASampleInterval.Seconds()/window.Seconds()),
+		isFloat:  true,
+	}
+
+	if err := met.scheduleRate(newRate); err != nil {
+		return err
+	}
+	met.rates[name] = newRate
+	met.setDefaultInfo(name, MetricInfo{Kind: MetricKindRate, Unit: "1/s"})
+
+	return nil
+}
+
+// NewEWMARates creates three EWMA rates with a window of 1, 5 and 15 minutes
+// for the given base metric. The rates are named name+"1m", name+"5m" and
+// name+"15m".
+func (met *Metrics) NewEWMARates(baseMetric string, name string) error {
+	windows := []struct {
+		suffix string
+		window time.Duration
+	}{
+		{"1m", time.Minute},
+		{"5m", 5 * time.Minute},
+		{"15m", 15 * time.Minute},
+	}
+
+	for _, w := range windows {
+		if err := met.NewEWMA(baseMetric, name+w.suffix, w.window); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateEWMA adds the change of the base metric since the last sample to the
+// moving average. The first sample only initializes the last known value.
+func (r *rate) updateEWMA(sample float64) {
+	delta := sample - r.lastSample
+	r.lastSample = sample
+	r.index++
+
+	switch {
+	case r.index == 1:
+		// First sample, no delta available yet
+	case r.index == 2:
+		r.set(delta / r.interval.Seconds())
+	default:
+		current := r.get()
+		r.set(current + r.alpha*(delta/r.interval.Seconds()-current))
+	}
+}
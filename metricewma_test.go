@@ -0,0 +1,125 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestEWMA(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+	defer mockMetric.Close()
+
+	mockMetric.New("messages")
+	expect.NotNil(mockMetric.NewEWMA("invalid", "load", time.Minute))
+	expect.NotNil(mockMetric.NewEWMA("messages", "load", time.Second))
+	expect.NoError(mockMetric.NewEWMARates("messages", "load"))
+	expect.NotNil(mockMetric.NewEWMA("messages", "load1m", time.Minute))
+
+	update := func() {
+		for _, name := range []string{"load1m", "load5m", "load15m"} {
+			mockMetric.updateRate(mockMetric.rates[name])
+		}
+	}
+
+	// First sample initializes, second sample seeds the average
+	mockMetric.Set("messages", 100)
+	update()
+	mockMetric.Add("messages", 50)
+	update()
+
+	for _, name := range []string{"load1m", "load5m", "load15m"} {
+		value, err := mockMetric.GetFloat(name)
+		expect.NoError(err)
+		expect.Equal(10.0, value)
+	}
+
+	// Rate drops to 0, shorter windows must react faster
+	update()
+
+	load1m, _ := mockMetric.GetFloat("load1m")
+	load5m, _ := mockMetric.GetFloat("load5m")
+	load15m, _ := mockMetric.GetFloat("load15m")
+
+	expect.Less(load1m, load5m)
+	expect.Less(load5m, load15m)
+	expect.Less(load15m, 10.0)
+
+	// alpha(1m) = 1 - e^(-5/60) ~ 0.08
+	expect.Geq(load1m, 9.19)
+	expect.Leq(load1m, 9.21)
+}
+
+func TestSampleScheduler(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	scheduler := newSampleScheduler()
+
+	fast := make(chan struct{}, 100)
+	slow := make(chan struct{}, 100)
+
+	scheduler.Add(10*time.Millisecond, func() { fast <- struct{}{} })
+	scheduler.Add(time.Hour, func() { slow <- struct{}{} })
+
+	expect.NonBlocking(time.Second, func() {
+		for i := 0; i < 3; i++ {
+			<-fast
+		}
+	})
+
+	scheduler.Stop()
+	expect.Equal(0, len(slow))
+	expect.Equal(0, len(scheduler.tasks))
+}
+
+func TestSchedulerRemove(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	scheduler := newSampleScheduler()
+	defer scheduler.Stop()
+
+	removed := make(chan struct{}, 100)
+	kept := make(chan struct{}, 100)
+
+	task, err := scheduler.Add(10*time.Millisecond, func() { removed <- struct{}{} })
+	expect.NoError(err)
+	scheduler.Add(10*time.Millisecond, func() { kept <- struct{}{} })
+	scheduler.Remove(task)
+	scheduler.Remove(task)
+
+	expect.NonBlocking(time.Second, func() {
+		for i := 0; i < 3; i++ {
+			<-kept
+		}
+	})
+	expect.Equal(0, len(removed))
+}
+
+func TestSchedulerInvalidInterval(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	scheduler := newSampleScheduler()
+	defer scheduler.Stop()
+
+	task, err := scheduler.Add(0, func() {})
+	expect.NotNil(err)
+	expect.Nil(task)
+
+	_, err = scheduler.Add(-time.Second, func() {})
+	expect.NotNil(err)
+	expect.False(scheduler.IsRunning())
+	expect.Equal(0, len(scheduler.tasks))
+}
@@ -0,0 +1,423 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// statsdMaxPacketSize is the maximum size of a single statsd UDP packet.
+	// This value is chosen to fit into a standard ethernet MTU.
+	statsdMaxPacketSize = 1432
+	// exporterTimeout is the timeout used for connecting and writing.
+	exporterTimeout = 5 * time.Second
+)
+
+// MetricExporter periodically pushes a snapshot of a Metrics store to a
+// remote endpoint. Counters are sent as the difference to the last
+// successful push, all other values are sent as they are.
+// By default, only metrics registered as MetricKindCounter are treated as
+// counters. Metrics without a registered kind are treated as gauges.
+type MetricExporter struct {
+	metrics    *Metrics
+	network    string
+	address    string
+	prefix     string
+	interval   time.Duration
+	encode     func(buffer *bytes.Buffer, sample exportSample, value float64, timestamp int64)
+	maxPacket  int
+	maxRetries int
+	retryDelay time.Duration
+	isCounter  func(name string) bool
+	conn       net.Conn
+	lastValues map[string]float64
+	guard      *sync.Mutex
+	pushGuard  *sync.Mutex
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+type exportSample struct {
+	name      string
+	value     float64
+	isCounter bool
+}
+
+// NewStatsdExporter creates an exporter sending metrics to a statsd server
+// via UDP. Counters are sent using the "c" type, all other metrics are sent
+// as gauges using the "g" type.
+// The prefix is prepended to all metric names, separated by a ".".
+// An error is returned if the interval is not positive.
+func NewStatsdExporter(m *Metrics, address string, prefix string, interval time.Duration) (*MetricExporter, error) {
+	exporter, err := newMetricExporter(m, "udp", address, prefix, interval)
+	if err != nil {
+		return nil, err
+	}
+	exporter.encode = encodeStatsd
+	exporter.maxPacket = statsdMaxPacketSize
+	return exporter, nil
+}
+
+// NewGraphiteExporter creates an exporter sending metrics to a graphite
+// server via TCP using the plaintext protocol.
+// The prefix is prepended to all metric names, separated by a ".".
+// An error is returned if the interval is not positive.
+func NewGraphiteExporter(m *Metrics, address string, prefix string, interval time.Duration) (*MetricExporter, error) {
+	exporter, err := newMetricExporter(m, "tcp", address, prefix, interval)
+	if err != nil {
+		return nil, err
+	}
+	exporter.encode = encodeGraphite
+	return exporter, nil
+}
+
+func newMetricExporter(m *Metrics, network string, address string, prefix string, interval time.Duration) (*MetricExporter, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("Exporter for %s requires a positive interval", address)
+	}
+	return &MetricExporter{
+		metrics:    m,
+		network:    network,
+		address:    address,
+		prefix:     strings.TrimRight(prefix, "."),
+		interval:   interval,
+		maxRetries: 3,
+		retryDelay: 100 * time.Millisecond,
+		isCounter:  m.isCounter,
+		lastValues: make(map[string]float64),
+		guard:      new(sync.Mutex),
+		pushGuard:  new(sync.Mutex),
+	}, nil
+}
+
+// SetRetry configures how often a failed push is retried. The delay between
+// retries starts at the given delay and is doubled after each retry.
+// It is not capped, but retries stop once the export interval is exceeded.
+func (exp *MetricExporter) SetRetry(maxRetries int, delay time.Duration) {
+	exp.guard.Lock()
+	defer exp.guard.Unlock()
+	exp.maxRetries = maxRetries
+	exp.retryDelay = delay
+}
+
+// SetCounterFilter sets the function used to decide if an integer metric is
+// a counter. Only counters are sent as deltas.
+func (exp *MetricExporter) SetCounterFilter(isCounter func(name string) bool) {
+	exp.guard.Lock()
+	defer exp.guard.Unlock()
+	exp.isCounter = isCounter
+}
+
+// Start starts pushing metrics in the configured interval. Calling Start
+// on a running exporter does nothing.
+func (exp *MetricExporter) Start() {
+	exp.guard.Lock()
+	defer exp.guard.Unlock()
+
+	if exp.stop != nil {
+		return // ### return, already running ###
+	}
+
+	exp.stop = make(chan struct{})
+	exp.done = make(chan struct{})
+	go exp.loop(exp.stop, exp.done)
+}
+
+// Stop stops pushing metrics and closes any open connection. This function
+// blocks until the exporter has stopped.
+func (exp *MetricExporter) Stop() {
+	exp.guard.Lock()
+	stop, done := exp.stop, exp.done
+	exp.stop, exp.done = nil, nil
+	exp.guard.Unlock()
+
+	if stop == nil {
+		return // ### return, not running ###
+	}
+
+	close(stop)
+	<-done
+
+	exp.guard.Lock()
+	exp.disconnect()
+	exp.guard.Unlock()
+}
+
+// Export pushes the current state of all metrics once. If sending fails it
+// is retried as configured by SetRetry. Counter deltas are only committed
+// if the push succeeded, so that no increments are lost.
+// Concurrent calls are serialized, but the exporter can be configured or
+// stopped while waiting for a retry.
+func (exp *MetricExporter) Export() error {
+	return exp.export(nil)
+}
+
+// export implements Export. Waiting for a retry is aborted when stop is
+// closed.
+func (exp *MetricExporter) export(stop <-chan struct{}) error {
+	exp.pushGuard.Lock()
+	defer exp.pushGuard.Unlock()
+
+	exp.guard.Lock()
+	isCounter, maxRetries, delay := exp.isCounter, exp.maxRetries, exp.retryDelay
+	exp.guard.Unlock()
+
+	samples := exp.metrics.exportSamples(isCounter)
+	timestamp := time.Now().Unix()
+
+	exp.guard.Lock()
+	buffers := exp.encodeSamples(samples, timestamp)
+	exp.guard.Unlock()
+
+	var err error
+	deadline := time.Now().Add(exp.interval)
+
+	for retry := 0; retry <= maxRetries; retry++ {
+		if retry > 0 {
+			if time.Now().Add(delay).After(deadline) {
+				break // ### break, next push is due ###
+			}
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-stop:
+				timer.Stop()
+				return err // ### return, exporter stopped ###
+			}
+			delay *= 2
+		}
+
+		exp.guard.Lock()
+		if err = exp.send(buffers); err == nil {
+			for _, sample := range samples {
+				if sample.isCounter {
+					exp.lastValues[sample.name] = sample.value
+				}
+			}
+			exp.guard.Unlock()
+			return nil // ### return, success ###
+		}
+		exp.disconnect()
+		exp.guard.Unlock()
+	}
+
+	return err
+}
+
+func (exp *MetricExporter) loop(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(exp.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return // ### return, stopped ###
+		case <-ticker.C:
+			if err := exp.export(stop); err != nil {
+				log.Print("Metrics: ", err)
+			}
+		}
+	}
+}
+
+// encodeSamples converts all samples into one or more buffers. Each buffer
+// is smaller than maxPacket unless a single line exceeds this size.
+func (exp *MetricExporter) encodeSamples(samples []exportSample, timestamp int64) []*bytes.Buffer {
+	buffers := []*bytes.Buffer{new(bytes.Buffer)}
+	line := new(bytes.Buffer)
+
+	for _, sample := range samples {
+		value := sample.value
+		if sample.isCounter {
+			if last, exists := exp.lastValues[sample.name]; exists && last <= value {
+				value -= last
+			}
+		}
+
+		if exp.prefix != "" {
+			sample.name = exp.prefix + "." + sample.name
+		}
+
+		line.Reset()
+		exp.encode(line, sample, value, timestamp)
+
+		current := buffers[len(buffers)-1]
+		if exp.maxPacket > 0 && current.Len() > 0 && current.Len()+line.Len() > exp.maxPacket {
+			current = new(bytes.Buffer)
+			buffers = append(buffers, current)
+		}
+		current.Write(line.Bytes())
+	}
+
+	return buffers
+}
+
+func (exp *MetricExporter) send(buffers []*bytes.Buffer) error {
+	if exp.conn == nil {
+		conn, err := net.DialTimeout(exp.network, exp.address, exporterTimeout)
+		if err != nil {
+			return err // ### return, connect failed ###
+		}
+		exp.conn = conn
+	}
+
+	for _, buffer := range buffers {
+		if buffer.Len() == 0 {
+			continue
+		}
+		exp.conn.SetWriteDeadline(time.Now().Add(exporterTimeout))
+		if _, err := exp.conn.Write(buffer.Bytes()); err != nil {
+			return err // ### return, write failed ###
+		}
+	}
+	return nil
+}
+
+func (exp *MetricExporter) disconnect() {
+	if exp.conn != nil {
+		exp.conn.Close()
+		exp.conn = nil
+	}
+}
+
+// exportSamples returns a flat list of all metric values. Labeled metrics,
+// histograms and summaries are split into multiple values using "." as a
+// separator. The list is sorted by name.
+func (met *Metrics) exportSamples(isCounter func(string) bool) []exportSample {
+	samples := []exportSample{}
+	counterCandidates := make(map[int]string)
+
+	met.storeGuard.RLock()
+	for name, value := range met.store {
+		counterCandidates[len(samples)] = name
+		samples = append(samples, exportSample{name, float64(atomic.LoadInt64(value)), false})
+	}
+	for name, value := range met.floats {
+		samples = append(samples, exportSample{name, math.Float64frombits(atomic.LoadUint64(value)), false})
+	}
+	for name, vec := range met.vecs {
+		for _, sample := range vec.snapshot() {
+			labelValues := make([]string, len(sample.labelValues))
+			for i, value := range sample.labelValues {
+				labelValues[i] = exportLabelValue(value)
+			}
+			sampleName := name + "." + strings.Join(labelValues, ".")
+			counterCandidates[len(samples)] = name
+			samples = append(samples, exportSample{sampleName, float64(sample.value), false})
+		}
+	}
+	for name, hist := range met.histograms {
+		snapshot := hist.Snapshot()
+		samples = append(samples,
+			exportSample{name + ".count", float64(snapshot.Count), true},
+			exportSample{name + ".sum", snapshot.Sum, false})
+	}
+	for name, summary := range met.summaries {
+		snapshot := summary.Snapshot()
+		samples = append(samples,
+			exportSample{name + ".count", float64(snapshot.Count), true},
+			exportSample{name + ".sum", snapshot.Sum, false})
+		for i, q := range snapshot.Quantiles {
+			if !math.IsNaN(snapshot.Values[i]) {
+				quantileName := name + ".p" + strings.Replace(formatFloat(q*100), ".", "_", -1)
+				samples = append(samples, exportSample{quantileName, snapshot.Values[i], false})
+			}
+		}
+	}
+	met.storeGuard.RUnlock()
+
+	met.rateGuard.RLock()
+	for name, rate := range met.rates {
+		samples = append(samples, exportSample{name, rate.get(), false})
+	}
+	met.rateGuard.RUnlock()
+
+	// isCounter may access the store, so it has to be called without locks
+	for idx, name := range counterCandidates {
+		samples[idx].isCounter = isCounter(name)
+	}
+
+	sort.Sort(exportSampleSlice(samples))
+	return samples
+}
+
+// encodeStatsd writes a sample using the statsd line protocol.
+func encodeStatsd(buffer *bytes.Buffer, sample exportSample, value float64, timestamp int64) {
+	buffer.WriteString(exportName(sample.name, ":|@\n "))
+	buffer.WriteByte(':')
+	buffer.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	if sample.isCounter {
+		buffer.WriteString("|c\n")
+	} else {
+		buffer.WriteString("|g\n")
+	}
+}
+
+// encodeGraphite writes a sample using the graphite plaintext protocol.
+func encodeGraphite(buffer *bytes.Buffer, sample exportSample, value float64, timestamp int64) {
+	buffer.WriteString(exportName(sample.name, "\n\t "))
+	buffer.WriteByte(' ')
+	buffer.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	buffer.WriteByte(' ')
+	buffer.WriteString(strconv.FormatInt(timestamp, 10))
+	buffer.WriteByte('\n')
+}
+
+// exportName replaces all given invalid characters in name by "_".
+func exportName(name string, invalid string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(invalid, r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// exportLabelValue converts a label value into a single path element by
+// replacing "." with "_". Empty values are exported as "_" so that no empty
+// path elements are generated.
+func exportLabelValue(value string) string {
+	if value == "" {
+		return "_"
+	}
+	return exportName(value, ".")
+}
+
+type exportSampleSlice []exportSample
+
+func (s exportSampleSlice) Len() int {
+	return len(s)
+}
+
+func (s exportSampleSlice) Less(i, j int) bool {
+	return s[i].name < s[j].name
+}
+
+func (s exportSampleSlice) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
@@ -0,0 +1,211 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestStatsdExporter(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	expect.NoError(err)
+	defer listener.Close()
+
+	mockMetric.NewWithInfo("messages", MetricInfo{Kind: MetricKindCounter})
+	mockMetric.Set("messages", 10)
+	mockMetric.New("queued")
+	mockMetric.Set("queued", 4)
+	mockMetric.NewFloat("load")
+	mockMetric.SetFloat("load", 0.5)
+
+	exporter, err := NewStatsdExporter(mockMetric, listener.LocalAddr().String(), "gollum.", time.Hour)
+	expect.NoError(err)
+	defer exporter.Stop()
+
+	readPacket := func() string {
+		buffer := make([]byte, statsdMaxPacketSize)
+		listener.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := listener.ReadFrom(buffer)
+		expect.NoError(err)
+		return string(buffer[:n])
+	}
+
+	expect.NoError(exporter.Export())
+	expect.Equal("gollum.load:0.5|g\ngollum.messages:10|c\ngollum.queued:4|g\n", readPacket())
+
+	// Only counters send deltas, unregistered metrics are gauges
+	mockMetric.Add("messages", 5)
+	mockMetric.Add("queued", 2)
+	expect.NoError(exporter.Export())
+	expect.Equal("gollum.load:0.5|g\ngollum.messages:5|c\ngollum.queued:6|g\n", readPacket())
+}
+
+func TestExporterInterval(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	exporter, err := NewStatsdExporter(mockMetric, "127.0.0.1:0", "", 0)
+	expect.NotNil(err)
+	expect.Nil(exporter)
+
+	exporter, err = NewGraphiteExporter(mockMetric, "127.0.0.1:0", "", -time.Second)
+	expect.NotNil(err)
+	expect.Nil(exporter)
+}
+
+func TestStatsdExporterPacketSize(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	for i := 0; i < 200; i++ {
+		mockMetric.New("a.rather.long.metric.name." + strings.Repeat("x", i%10) + string(rune('a'+i%26)) + string(rune('a'+i/26)))
+	}
+
+	exporter, err := NewStatsdExporter(mockMetric, "127.0.0.1:0", "", time.Hour)
+	expect.NoError(err)
+	buffers := exporter.encodeSamples(mockMetric.exportSamples(mockMetric.isCounter), 0)
+
+	expect.Greater(len(buffers), 1)
+	for _, buffer := range buffers {
+		expect.Leq(buffer.Len(), statsdMaxPacketSize)
+	}
+}
+
+func TestGraphiteExporter(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	expect.NoError(err)
+	defer listener.Close()
+
+	lines := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- line
+		}
+	}()
+
+	mockMetric.NewWithInfo("messages", MetricInfo{Kind: MetricKindCounter})
+	mockMetric.Set("messages", 3)
+
+	exporter, err := NewGraphiteExporter(mockMetric, listener.Addr().String(), "gollum", 50*time.Millisecond)
+	expect.NoError(err)
+	exporter.Start()
+	defer exporter.Stop()
+
+	expect.NonBlocking(time.Second, func() {
+		fields := strings.Fields(<-lines)
+		expect.Equal(3, len(fields))
+		expect.Equal("gollum.messages", fields[0])
+		expect.Equal("3", fields[1])
+	})
+
+	mockMetric.Add("messages", 2)
+	expect.NonBlocking(time.Second, func() {
+		for {
+			fields := strings.Fields(<-lines)
+			if fields[1] != "0" {
+				expect.Equal("2", fields[1])
+				return
+			}
+		}
+	})
+}
+
+func TestExporterRetry(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	// Reserve a port and close it again so that connecting fails
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	expect.NoError(err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	mockMetric.NewWithInfo("messages", MetricInfo{Kind: MetricKindCounter})
+	mockMetric.Set("messages", 7)
+
+	exporter, err := NewGraphiteExporter(mockMetric, address, "", time.Hour)
+	expect.NoError(err)
+	exporter.SetRetry(2, time.Millisecond)
+
+	start := time.Now()
+	expect.NotNil(exporter.Export())
+	expect.Geq(int64(time.Since(start)), int64(3*time.Millisecond))
+
+	// Failed pushes must not commit counter values
+	expect.MapNotSet(exporter.lastValues, "messages")
+}
+
+func TestExporterRetryUnlocked(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	expect.NoError(err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	exporter, err := NewGraphiteExporter(mockMetric, address, "", time.Hour)
+	expect.NoError(err)
+	exporter.SetRetry(1, time.Minute)
+	exporter.Start()
+
+	// Give the exporter time to fail and to wait for the retry
+	go exporter.Export()
+	time.Sleep(50 * time.Millisecond)
+
+	// Configuring the exporter must not wait for the retry
+	expect.NonBlocking(time.Second, func() {
+		exporter.SetRetry(0, time.Millisecond)
+	})
+	expect.NonBlocking(time.Second, exporter.Stop)
+}
+
+func TestExporterLabelValues(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	vec, err := mockMetric.NewVec("requests", 0, "host", "code")
+	expect.NoError(err)
+	handle, err := vec.WithLabels("www.example.com", "")
+	expect.NoError(err)
+	handle.Set(3)
+
+	samples := mockMetric.exportSamples(mockMetric.isCounter)
+	expect.Equal(1, len(samples))
+	expect.Equal("requests.www_example_com._", samples[0].name)
+	expect.Equal(float64(3), samples[0].value)
+}
@@ -0,0 +1,104 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+)
+
+// NewFloat creates a new float metric under the given name with a value of 0.
+// Float metrics keep their full precision, i.e. they are not rounded like
+// values passed to SetF.
+// If the name is already used by a metric of another type, e.g. an integer
+// metric, no metric is created and all writes using the float functions
+// like SetFloat or AddFloat are ignored. A warning is written to
+// tlog.Warning in this case.
+func (met *Metrics) NewFloat(name string) {
+	met.newFloat(name)
+}
+
+// SetFloat sets a given float metric to a given value.
+func (met *Metrics) SetFloat(name string, value float64) {
+	atomic.StoreUint64(met.getFloat(name), math.Float64bits(value))
+}
+
+// AddFloat adds a number to a given float metric.
+func (met *Metrics) AddFloat(name string, value float64) {
+	atomicAddFloat64(met.getFloat(name), value)
+}
+
+// SubFloat subtracts a number from a given float metric.
+func (met *Metrics) SubFloat(name string, value float64) {
+	atomicAddFloat64(met.getFloat(name), -value)
+}
+
+// GetFloat returns the value of a given float metric, integer metric or rate.
+// Integer metrics are converted to float64.
+// If the value does not exists error is non-nil and the returned value is 0.
+func (met *Metrics) GetFloat(name string) (float64, error) {
+	if metric := met.tryGetFloat(name); metric != nil {
+		return math.Float64frombits(atomic.LoadUint64(metric)), nil
+	}
+
+	if metric := met.tryGetMetric(name); metric != nil {
+		return float64(atomic.LoadInt64(metric)), nil
+	}
+
+	if rate := met.tryGetRate(name); rate != nil {
+		return rate.get(), nil
+	}
+
+	// Neither rate nor metric found
+	return 0, fmt.Errorf("Metric %s not found", name)
+}
+
+func (met *Metrics) newFloat(name string) *uint64 {
+	met.storeGuard.Lock()
+	defer met.storeGuard.Unlock()
+
+	value, exists := met.floats[name]
+	if exists {
+		return value // ### return, exists ###
+	}
+
+	value = new(uint64)
+	if err := met.checkUnused(name); err != nil {
+		met.reject(name, err)
+		return value // ### return, detached value ###
+	}
+
+	met.floats[name] = value
+	return value
+}
+
+func (met *Metrics) getFloat(name string) *uint64 {
+	if v := met.tryGetFloat(name); v != nil {
+		return v // ### return, exists ###
+	}
+	return met.newFloat(name)
+}
+
+func (met *Metrics) tryGetFloat(name string) *uint64 {
+	met.storeGuard.RLock()
+	v, exists := met.floats[name]
+	met.storeGuard.RUnlock()
+
+	if exists {
+		return v // ### return, exists ###
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/trivago/tgo/tlog"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestMetricsFloat(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	mockMetric.NewFloat("ratio")
+	value, err := mockMetric.GetFloat("ratio")
+	expect.NoError(err)
+	expect.Equal(0.0, value)
+
+	mockMetric.SetFloat("ratio", 0.25)
+	mockMetric.AddFloat("ratio", 0.5)
+	mockMetric.SubFloat("ratio", 0.125)
+
+	value, err = mockMetric.GetFloat("ratio")
+	expect.NoError(err)
+	expect.Equal(0.625, value)
+
+	mockMetric.New("int")
+	mockMetric.Set("int", 3)
+	value, err = mockMetric.GetFloat("int")
+	expect.NoError(err)
+	expect.Equal(3.0, value)
+
+	_, err = mockMetric.GetFloat("unknown")
+	expect.NotNil(err)
+
+	data, err := mockMetric.Dump()
+	expect.NoError(err)
+
+	values := make(map[string]float64)
+	expect.NoError(json.Unmarshal(data, &values))
+	expect.MapEqual(values, "ratio", 0.625)
+
+	buffer := new(bytes.Buffer)
+	expect.NoError(mockMetric.WritePrometheus(buffer))
+	expect.Contains(buffer.String(), "ratio 0.625\n")
+
+	mockMetric.ResetMetrics()
+	value, err = mockMetric.GetFloat("ratio")
+	expect.NoError(err)
+	expect.Equal(0.0, value)
+}
+
+func TestMetricsFloatCollisions(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	buffer := new(bytes.Buffer)
+	tlog.SetVerbosity(tlog.VerbosityWarning)
+	tlog.SetWriter(buffer)
+	defer tlog.SetWriter(os.Stderr)
+	defer tlog.SetVerbosity(tlog.VerbosityError)
+
+	mockMetric.SetFloat("ratio", 2.5)
+	mockMetric.Set("count", 3)
+
+	// Integer functions do not create a second metric
+	mockMetric.Set("ratio", 10)
+	mockMetric.Inc("ratio")
+	mockMetric.Handle("ratio").Inc()
+	mockMetric.SetFloat("count", 7.5)
+	expect.Contains(buffer.String(), "Metric ratio is already registered as float metric")
+	expect.Contains(buffer.String(), "Metric count is already registered as integer metric")
+
+	// Warnings are written once per name
+	buffer.Reset()
+	mockMetric.Set("ratio", 10)
+	expect.Equal(0, buffer.Len())
+
+	// Float metrics are rounded by Get
+	value, err := mockMetric.Get("ratio")
+	expect.NoError(err)
+	expect.Equal(int64(3), value)
+
+	floatValue, err := mockMetric.GetFloat("count")
+	expect.NoError(err)
+	expect.Equal(3.0, floatValue)
+
+	data, err := mockMetric.Dump()
+	expect.NoError(err)
+
+	values := make(map[string]float64)
+	expect.NoError(json.Unmarshal(data, &values))
+	expect.MapEqual(values, "ratio", 2.5)
+	expect.MapEqual(values, "count", 3.0)
+
+	// Removed names can be reused with another type
+	mockMetric.Remove("ratio")
+	mockMetric.Set("ratio", 4)
+	value, err = mockMetric.Get("ratio")
+	expect.NoError(err)
+	expect.Equal(int64(4), value)
+}
+
+func TestRateFloat(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+	defer mockMetric.Close()
+
+	mockMetric.NewFloat("load")
+	err := mockMetric.NewRate("load", "mean", time.Hour, 4, 1, false)
+	expect.NoError(err)
+
+	for _, v := range []float64{0.1, 0.2, 0.3, 0.4} {
+		mockMetric.SetFloat("load", v)
+		for _, r := range mockMetric.rates {
+			mockMetric.updateRate(r)
+		}
+	}
+
+	value, err := mockMetric.GetFloat("mean")
+	expect.NoError(err)
+	expect.Geq(value, 0.2499)
+	expect.Leq(value, 0.2501)
+
+	intValue, err := mockMetric.Get("mean")
+	expect.NoError(err)
+	expect.Equal(int64(0), intValue)
+}
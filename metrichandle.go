@@ -0,0 +1,83 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"sync/atomic"
+)
+
+// MetricHandle gives direct access to a single metric value. Modifying a
+// metric through a handle does not require a lookup by name, i.e. each call
+// costs only the atomic operation.
+// Updates through a handle do not trigger counter warnings as enabled by
+// EnableCounterWarnings.
+type MetricHandle struct {
+	value *int64
+}
+
+// Handle returns a handle to the metric of the given name. If the metric
+// does not exist yet it is created with a value of 0.
+// If the metric is removed, the handle stays valid but is not reported
+// anymore. A metric created again under the same name is not connected to
+// the handle.
+func (met *Metrics) Handle(name string) *MetricHandle {
+	return &MetricHandle{met.get(name)}
+}
+
+// Counter works like Handle and registers the metric as MetricKindCounter
+// if no metadata has been registered for it yet.
+func (met *Metrics) Counter(name string) *MetricHandle {
+	handle := met.Handle(name)
+	met.setDefaultInfo(name, MetricInfo{Kind: MetricKindCounter})
+	return handle
+}
+
+// Gauge works like Handle and registers the metric as MetricKindGauge if no
+// metadata has been registered for it yet.
+func (met *Metrics) Gauge(name string) *MetricHandle {
+	handle := met.Handle(name)
+	met.setDefaultInfo(name, MetricInfo{Kind: MetricKindGauge})
+	return handle
+}
+
+// Set sets the metric to a given value.
+func (handle *MetricHandle) Set(value int64) {
+	atomic.StoreInt64(handle.value, value)
+}
+
+// Inc adds 1 to the metric.
+func (handle *MetricHandle) Inc() {
+	atomic.AddInt64(handle.value, 1)
+}
+
+// Dec subtracts 1 from the metric.
+func (handle *MetricHandle) Dec() {
+	atomic.AddInt64(handle.value, -1)
+}
+
+// Add adds a number to the metric.
+func (handle *MetricHandle) Add(value int64) {
+	atomic.AddInt64(handle.value, value)
+}
+
+// Sub subtracts a number from the metric.
+func (handle *MetricHandle) Sub(value int64) {
+	atomic.AddInt64(handle.value, -value)
+}
+
+// Get returns the current value of the metric.
+func (handle *MetricHandle) Get() int64 {
+	return atomic.LoadInt64(handle.value)
+}
@@ -0,0 +1,130 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"testing"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestMetricHandle(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	counter := mockMetric.Counter("requests")
+	counter.Inc()
+	counter.Add(4)
+	mockMetric.Inc("requests")
+
+	value, err := mockMetric.Get("requests")
+	expect.NoError(err)
+	expect.Equal(int64(6), value)
+	expect.Equal(int64(6), counter.Get())
+	expect.Equal(int64(6), mockMetric.Handle("requests").Get())
+
+	info, _ := mockMetric.GetInfo("requests")
+	expect.Equal(MetricKindCounter, info.Kind)
+
+	mockMetric.Set("queue", 10)
+	gauge := mockMetric.Gauge("queue")
+	expect.Equal(int64(10), gauge.Get())
+	gauge.Dec()
+	gauge.Sub(4)
+
+	value, err = mockMetric.Get("queue")
+	expect.NoError(err)
+	expect.Equal(int64(5), value)
+
+	info, _ = mockMetric.GetInfo("queue")
+	expect.Equal(MetricKindGauge, info.Kind)
+
+	// Existing metadata is kept
+	mockMetric.NewWithInfo("latency", MetricInfo{Kind: MetricKindGauge, Unit: "ms"})
+	mockMetric.Counter("latency")
+	info, _ = mockMetric.GetInfo("latency")
+	expect.Equal(MetricKindGauge, info.Kind)
+	expect.Equal("ms", info.Unit)
+
+	// Removed metrics are not connected to the handle anymore
+	mockMetric.Remove("requests")
+	counter.Inc()
+	_, err = mockMetric.Get("requests")
+	expect.NotNil(err)
+}
+
+func BenchmarkMetricIncByName(b *testing.B) {
+	mockMetric := getMockMetric()
+	mockMetric.New("counter")
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		mockMetric.Inc("counter")
+	}
+}
+
+func BenchmarkMetricIncByHandle(b *testing.B) {
+	mockMetric := getMockMetric()
+	counter := mockMetric.Counter("counter")
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		counter.Inc()
+	}
+}
+
+func BenchmarkMetricIncByNameParallel(b *testing.B) {
+	mockMetric := getMockMetric()
+	mockMetric.New("counter")
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			mockMetric.Inc("counter")
+		}
+	})
+}
+
+func BenchmarkMetricIncByHandleParallel(b *testing.B) {
+	mockMetric := getMockMetric()
+	counter := mockMetric.Counter("counter")
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			counter.Inc()
+		}
+	})
+}
+
+func BenchmarkMetricSetByName(b *testing.B) {
+	mockMetric := getMockMetric()
+	mockMetric.New("gauge")
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		mockMetric.Set("gauge", int64(i))
+	}
+}
+
+func BenchmarkMetricSetByHandle(b *testing.B) {
+	mockMetric := getMockMetric()
+	gauge := mockMetric.Gauge("gauge")
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		gauge.Set(int64(i))
+	}
+}
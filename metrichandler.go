@@ -0,0 +1,151 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/trivago/tgo/tnet/thttp"
+)
+
+// MetricFilter is used to select metrics by name. A nil filter accepts all
+// metrics.
+type MetricFilter func(name string) bool
+
+// MetricHandler is a http.Handler that writes all metrics of a Metrics store
+// either as JSON (see Metrics.Dump) or in the prometheus text exposition
+// format, depending on the Accept header of the request. JSON is used if
+// both formats are accepted equally. If neither format is accepted, e.g. if
+// only application/openmetrics-text is accepted, the request is answered
+// with 406 Not Acceptable.
+//
+// The metrics written can be filtered by using the query parameters "prefix"
+// and "regex". Both parameters may be passed multiple times. A metric is
+// written if its name matches any of the given prefixes or expressions.
+type MetricHandler struct {
+	metrics *Metrics
+}
+
+// NewMetricHandler creates a new http handler for the given metrics store.
+func NewMetricHandler(m *Metrics) MetricHandler {
+	return MetricHandler{
+		metrics: m,
+	}
+}
+
+// NewPrefixFilter creates a filter accepting all metrics starting with any
+// of the given prefixes.
+func NewPrefixFilter(prefixes ...string) MetricFilter {
+	return func(name string) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// NewRegexFilter creates a filter accepting all metrics matching any of the
+// given regular expressions.
+func NewRegexFilter(expressions ...*regexp.Regexp) MetricFilter {
+	return func(name string) bool {
+		for _, expr := range expressions {
+			if expr.MatchString(name) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (handler MetricHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	filter, err := filterFromQuery(req)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return // ### return, invalid filter ###
+	}
+
+	switch negotiateMetricFormat(req.Header.Get("Accept")) {
+	case "":
+		http.Error(rw, "Metrics are available as application/json or text/plain", http.StatusNotAcceptable)
+		return // ### return, no acceptable format ###
+
+	case "text/plain":
+		rw.Header().Set("Content-Type", PrometheusContentType)
+		if err := handler.metrics.WritePrometheusFiltered(rw, filter); err != nil {
+			log.Print("Metrics: ", err)
+		}
+		return // ### return, text format written ###
+	}
+
+	data, err := handler.metrics.DumpFiltered(filter)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return // ### return, dump failed ###
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(data)
+	rw.Write([]byte{'\n'})
+}
+
+// accepts returns true if the filter is nil or accepts the given name.
+func (filter MetricFilter) accepts(name string) bool {
+	return filter == nil || filter(name)
+}
+
+// filterFromQuery creates a filter from the "prefix" and "regex" query
+// parameters. If no parameter is set, nil is returned.
+func filterFromQuery(req *http.Request) (MetricFilter, error) {
+	query := req.URL.Query()
+	prefixes := query["prefix"]
+	expressions := make([]*regexp.Regexp, 0, len(query["regex"]))
+
+	for _, expr := range query["regex"] {
+		compiled, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		expressions = append(expressions, compiled)
+	}
+
+	switch {
+	case len(prefixes) == 0 && len(expressions) == 0:
+		return nil, nil
+	case len(expressions) == 0:
+		return NewPrefixFilter(prefixes...), nil
+	case len(prefixes) == 0:
+		return NewRegexFilter(expressions...), nil
+	}
+
+	prefixFilter := NewPrefixFilter(prefixes...)
+	regexFilter := NewRegexFilter(expressions...)
+	return func(name string) bool {
+		return prefixFilter(name) || regexFilter(name)
+	}, nil
+}
+
+// negotiateMetricFormat parses an Accept header and returns the preferred
+// content type, i.e. "application/json" or "text/plain" for the prometheus
+// text format. The openmetrics format is not supported. If neither type is
+// acceptable, an empty string is returned.
+func negotiateMetricFormat(accept string) string {
+	return thttp.NegotiateContentType(accept, "application/json", "text/plain")
+}
@@ -0,0 +1,145 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestNegotiateMetricFormat(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	expect.Equal("application/json", negotiateMetricFormat(""))
+	expect.Equal("application/json", negotiateMetricFormat("*/*"))
+	expect.Equal("application/json", negotiateMetricFormat("application/json"))
+	expect.Equal("application/json", negotiateMetricFormat("text/plain;q=0.5, application/json"))
+	expect.Equal("application/json", negotiateMetricFormat("text/plain;q=0, */*"))
+	expect.Equal("text/plain", negotiateMetricFormat("text/plain"))
+	expect.Equal("text/plain", negotiateMetricFormat("application/json;q=0, */*"))
+	expect.Equal("text/plain", negotiateMetricFormat("text/plain; version=0.0.4, */*;q=0.1"))
+	expect.Equal("text/plain", negotiateMetricFormat("application/openmetrics-text; version=1.0.0,text/plain;version=0.0.4;q=0.5,*/*;q=0.1"))
+	expect.Equal("", negotiateMetricFormat("application/openmetrics-text"))
+}
+
+func TestMetricHandler(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	mockMetric.New("consumer.kafka.messages")
+	mockMetric.Set("consumer.kafka.messages", 3)
+	mockMetric.New("consumer.file.messages")
+	mockMetric.New("producer.kafka.messages")
+
+	handler := NewMetricHandler(mockMetric)
+	serve := func(target string, accept string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", target, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	response := serve("/metrics", "")
+	expect.Equal("application/json", response.Header().Get("Content-Type"))
+	values := make(map[string]int64)
+	expect.NoError(json.Unmarshal(response.Body.Bytes(), &values))
+	expect.Equal(3, len(values))
+
+	response = serve("/metrics?prefix=consumer.", "application/json")
+	values = make(map[string]int64)
+	expect.NoError(json.Unmarshal(response.Body.Bytes(), &values))
+	expect.Equal(2, len(values))
+	expect.MapEqual(values, "consumer.kafka.messages", int64(3))
+
+	response = serve("/metrics?regex=%5Ekafka|%5C.kafka%5C.&prefix=consumer.file", "text/plain")
+	expect.Equal(PrometheusContentType, response.Header().Get("Content-Type"))
+	body := response.Body.String()
+	expect.Contains(body, "consumer_kafka_messages 3\n")
+	expect.Contains(body, "producer_kafka_messages 0\n")
+	expect.Contains(body, "consumer_file_messages 0\n")
+
+	response = serve("/metrics?regex=%5Eproducer", "text/plain")
+	expect.Equal("# HELP producer_kafka_messages producer.kafka.messages\n"+
+		"# TYPE producer_kafka_messages untyped\n"+
+		"producer_kafka_messages 0\n", response.Body.String())
+
+	response = serve("/metrics?regex=(", "")
+	expect.Equal(http.StatusBadRequest, response.Code)
+
+	response = serve("/metrics", "application/openmetrics-text; version=1.0.0")
+	expect.Equal(http.StatusNotAcceptable, response.Code)
+
+	// Write errors are logged
+	logBuffer := new(bytes.Buffer)
+	log.SetOutput(logBuffer)
+	defer log.SetOutput(os.Stderr)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "text/plain")
+	handler.ServeHTTP(failingResponseWriter{httptest.NewRecorder()}, req)
+	expect.Contains(logBuffer.String(), "Metrics: connection closed")
+}
+
+func TestMetricServerHTTP(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+	mockMetric.New("foo")
+
+	// Reserve a free port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	expect.NoError(err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	server := NewMetricServerFor(mockMetric)
+	stopped := make(chan struct{})
+	go func() {
+		server.StartHTTP(address)
+		close(stopped)
+	}()
+
+	var response *http.Response
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+		if response, err = http.Get("http://" + address + "/metrics"); err == nil {
+			break
+		}
+	}
+	expect.NoError(err)
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	expect.NoError(err)
+	expect.Contains(string(body), "\"foo\":0")
+
+	response, err = http.Get("http://" + address + "/other")
+	expect.NoError(err)
+	response.Body.Close()
+	expect.Equal(http.StatusNotFound, response.StatusCode)
+
+	server.Stop()
+	expect.NonBlocking(time.Second, func() { <-stopped })
+}
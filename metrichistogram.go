@@ -0,0 +1,164 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+// DefaultHistogramBuckets are the bucket upper bounds used by NewHistogram
+// if no buckets are given. They are tailored to measure latencies in seconds.
+var DefaultHistogramBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Histogram counts observations in a set of buckets defined by their upper
+// bounds. Observing a value is lock-free.
+type Histogram struct {
+	count  uint64
+	sum    uint64
+	bounds []float64
+	counts []uint64
+}
+
+// HistogramSnapshot holds the state of a histogram at a given point in time.
+// Buckets are cumulative, i.e. each bucket contains the number of observations
+// less than or equal to the bucket's upper bound. The last bucket always has
+// an upper bound of +Inf.
+type HistogramSnapshot struct {
+	Bounds  []float64
+	Buckets []uint64
+	Count   uint64
+	Sum     float64
+}
+
+// NewHistogram creates a new histogram with the given bucket upper bounds.
+// If no buckets are given, DefaultHistogramBuckets is used. A bucket for
+// +Inf is always added implicitly.
+// Registering a name that is already used by another metric fails.
+func (met *Metrics) NewHistogram(name string, buckets ...float64) (*Histogram, error) {
+	if len(buckets) == 0 {
+		buckets = DefaultHistogramBuckets
+	}
+
+	bounds := make([]float64, 0, len(buckets))
+	for _, b := range buckets {
+		if !math.IsInf(b, 1) {
+			bounds = append(bounds, b)
+		}
+	}
+	sort.Float64s(bounds)
+
+	for i := 1; i < len(bounds); i++ {
+		if bounds[i] == bounds[i-1] {
+			return nil, fmt.Errorf("Histogram %s has duplicate bucket %v", name, bounds[i])
+		}
+	}
+
+	met.storeGuard.Lock()
+	defer met.storeGuard.Unlock()
+
+	if err := met.checkUnused(name); err != nil {
+		return nil, err
+	}
+
+	hist := &Histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+	met.histograms[name] = hist
+	return hist, nil
+}
+
+// GetHistogram returns the histogram registered under the given name.
+// If no such histogram exists, nil is returned.
+func (met *Metrics) GetHistogram(name string) *Histogram {
+	met.storeGuard.RLock()
+	defer met.storeGuard.RUnlock()
+	return met.histograms[name]
+}
+
+// Observe adds a value to the histogram.
+func (hist *Histogram) Observe(value float64) {
+	idx := sort.SearchFloat64s(hist.bounds, value)
+	atomic.AddUint64(&hist.counts[idx], 1)
+	atomic.AddUint64(&hist.count, 1)
+	atomicAddFloat64(&hist.sum, value)
+}
+
+// Snapshot returns the current state of the histogram.
+func (hist *Histogram) Snapshot() HistogramSnapshot {
+	snapshot := HistogramSnapshot{
+		Bounds:  append(append([]float64(nil), hist.bounds...), math.Inf(1)),
+		Buckets: make([]uint64, len(hist.counts)),
+		Count:   atomic.LoadUint64(&hist.count),
+		Sum:     math.Float64frombits(atomic.LoadUint64(&hist.sum)),
+	}
+
+	total := uint64(0)
+	for i := range hist.counts {
+		total += atomic.LoadUint64(&hist.counts[i])
+		snapshot.Buckets[i] = total
+	}
+	return snapshot
+}
+
+func (hist *Histogram) reset() {
+	for i := range hist.counts {
+		atomic.StoreUint64(&hist.counts[i], 0)
+	}
+	atomic.StoreUint64(&hist.count, 0)
+	atomic.StoreUint64(&hist.sum, 0)
+}
+
+// dumpValue returns a JSON friendly representation of the histogram state.
+func (snapshot HistogramSnapshot) dumpValue() map[string]interface{} {
+	buckets := make(map[string]uint64, len(snapshot.Buckets))
+	for i, bound := range snapshot.Bounds {
+		buckets[formatFloat(bound)] = snapshot.Buckets[i]
+	}
+
+	return map[string]interface{}{
+		"count":   snapshot.Count,
+		"sum":     snapshot.Sum,
+		"buckets": buckets,
+	}
+}
+
+// atomicAddFloat64 adds delta to the float64 stored as bit pattern in addr.
+func atomicAddFloat64(addr *uint64, delta float64) float64 {
+	for {
+		oldBits := atomic.LoadUint64(addr)
+		newValue := math.Float64frombits(oldBits) + delta
+		if atomic.CompareAndSwapUint64(addr, oldBits, math.Float64bits(newValue)) {
+			return newValue
+		}
+	}
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"bytes"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestHistogram(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	_, err := mockMetric.NewHistogram("invalid", 1, 2, 2)
+	expect.NotNil(err)
+
+	hist, err := mockMetric.NewHistogram("latency", 10, 1, 5)
+	expect.NoError(err)
+
+	_, err = mockMetric.NewHistogram("latency")
+	expect.NotNil(err)
+	expect.Equal(hist, mockMetric.GetHistogram("latency"))
+
+	for _, v := range []float64{0.5, 1, 3, 7, 20} {
+		hist.Observe(v)
+	}
+
+	// bounds  : 1  5  10  +Inf
+	// buckets : 2  3  4   5
+	snapshot := hist.Snapshot()
+	expect.Equal(uint64(5), snapshot.Count)
+	expect.Equal(31.5, snapshot.Sum)
+	expect.Equal(4, len(snapshot.Buckets))
+	expect.Equal(uint64(2), snapshot.Buckets[0])
+	expect.Equal(uint64(3), snapshot.Buckets[1])
+	expect.Equal(uint64(4), snapshot.Buckets[2])
+	expect.Equal(uint64(5), snapshot.Buckets[3])
+	expect.True(math.IsInf(snapshot.Bounds[3], 1))
+
+	buffer := new(bytes.Buffer)
+	expect.NoError(mockMetric.WritePrometheus(buffer))
+
+	expected := "# HELP latency latency\n" +
+		"# TYPE latency histogram\n" +
+		"latency_bucket{le=\"1\"} 2\n" +
+		"latency_bucket{le=\"5\"} 3\n" +
+		"latency_bucket{le=\"10\"} 4\n" +
+		"latency_bucket{le=\"+Inf\"} 5\n" +
+		"latency_sum 31.5\n" +
+		"latency_count 5\n"
+	expect.Equal(expected, buffer.String())
+
+	mockMetric.ResetMetrics()
+	expect.Equal(uint64(0), hist.Snapshot().Count)
+}
+
+func TestHistogramConcurrent(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	hist, err := mockMetric.NewHistogram("concurrent")
+	expect.NoError(err)
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 1000; n++ {
+				hist.Observe(0.5)
+			}
+		}()
+	}
+	wg.Wait()
+
+	snapshot := hist.Snapshot()
+	expect.Equal(uint64(10000), snapshot.Count)
+	expect.Equal(5000.0, snapshot.Sum)
+}
+
+func TestHistogramNameCollisions(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	mockMetric.New("counter")
+	mockMetric.NewFloat("float")
+	_, err := mockMetric.NewVec("family", 0, "label")
+	expect.NoError(err)
+	_, err = mockMetric.NewHistogram("histogram")
+	expect.NoError(err)
+	_, err = mockMetric.NewSummary("summary", time.Minute)
+	expect.NoError(err)
+
+	for _, name := range []string{"counter", "float", "family", "histogram", "summary"} {
+		_, err = mockMetric.NewHistogram(name)
+		expect.NotNil(err)
+		_, err = mockMetric.NewSummary(name, time.Minute)
+		expect.NotNil(err)
+	}
+
+	_, err = mockMetric.NewVec("histogram", 0, "label")
+	expect.NotNil(err)
+	_, err = mockMetric.NewVec("family", 0, "label")
+	expect.NoError(err)
+}
@@ -0,0 +1,149 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+
+	"github.com/trivago/tgo/tlog"
+)
+
+// MetricKind defines an enumeration for the type of a metric
+type MetricKind byte
+
+const (
+	// MetricKindUntyped is used for metrics without a registered type
+	MetricKindUntyped = MetricKind(iota)
+	// MetricKindCounter is used for metrics that are only increased
+	MetricKindCounter = MetricKind(iota)
+	// MetricKindGauge is used for metrics that may increase and decrease
+	MetricKindGauge = MetricKind(iota)
+	// MetricKindRate is used for rates created by NewRate
+	MetricKindRate = MetricKind(iota)
+)
+
+// MetricInfo holds metadata describing a metric.
+type MetricInfo struct {
+	Kind MetricKind
+	Unit string
+	Help string
+}
+
+// String returns the lowercase name of the metric kind.
+func (kind MetricKind) String() string {
+	switch kind {
+	case MetricKindCounter:
+		return "counter"
+	case MetricKindGauge:
+		return "gauge"
+	case MetricKindRate:
+		return "rate"
+	default:
+		return "untyped"
+	}
+}
+
+// NewWithInfo creates a new metric under the given name with a value of 0
+// and registers the given metadata for it.
+func (met *Metrics) NewWithInfo(name string, info MetricInfo) {
+	met.new(name)
+	met.SetInfo(name, info)
+}
+
+// SetInfo registers metadata for the given metric, rate, labeled metric
+// family, histogram or summary. Existing metadata is overwritten.
+func (met *Metrics) SetInfo(name string, info MetricInfo) {
+	met.storeGuard.Lock()
+	met.infos[name] = info
+	met.storeGuard.Unlock()
+}
+
+// GetInfo returns the metadata registered for the given name. If no
+// metadata has been registered, false is returned.
+func (met *Metrics) GetInfo(name string) (MetricInfo, bool) {
+	met.storeGuard.RLock()
+	info, exists := met.infos[name]
+	met.storeGuard.RUnlock()
+	return info, exists
+}
+
+// EnableCounterWarnings enables or disables warnings for decreasing a metric
+// registered as MetricKindCounter. Warnings are written to tlog.Warning.
+// Enabling warnings adds a metadata lookup to every decreasing call to Set,
+// Sub, Dec or Add.
+func (met *Metrics) EnableCounterWarnings(enable bool) {
+	if enable {
+		atomic.StoreInt32(&met.warnings, 1)
+	} else {
+		atomic.StoreInt32(&met.warnings, 0)
+	}
+}
+
+// DumpWithInfo creates a JSON string from all stored metrics like Dump.
+// Each value is stored as an object with the fields "value", "kind", "unit"
+// and "help". Labeled metrics use the metadata of their metric family.
+func (met *Metrics) DumpWithInfo() ([]byte, error) {
+	snapshot := met.snapshot(nil)
+	dump := make(map[string]interface{}, len(snapshot))
+
+	met.storeGuard.RLock()
+	for key, value := range snapshot {
+		name := key
+		if idx := strings.IndexByte(key, '{'); idx > 0 {
+			name = key[:idx]
+		}
+
+		info := met.infos[name]
+		entry := map[string]interface{}{
+			"value": value,
+			"kind":  info.Kind.String(),
+		}
+		if info.Unit != "" {
+			entry["unit"] = info.Unit
+		}
+		if info.Help != "" {
+			entry["help"] = info.Help
+		}
+		dump[key] = entry
+	}
+	met.storeGuard.RUnlock()
+
+	return json.Marshal(dump)
+}
+
+// setDefaultInfo registers metadata for the given name if no metadata has
+// been registered yet.
+func (met *Metrics) setDefaultInfo(name string, info MetricInfo) {
+	met.storeGuard.Lock()
+	if _, exists := met.infos[name]; !exists {
+		met.infos[name] = info
+	}
+	met.storeGuard.Unlock()
+}
+
+// isCounter returns true if the given metric is registered as counter.
+// Metrics without metadata are not considered counters.
+func (met *Metrics) isCounter(name string) bool {
+	info, exists := met.GetInfo(name)
+	return exists && info.Kind == MetricKindCounter
+}
+
+func (met *Metrics) warnDecrease(name string, delta int64) {
+	if info, exists := met.GetInfo(name); exists && info.Kind == MetricKindCounter {
+		tlog.Warning.Printf("Counter %s has been decreased by %d", name, -delta)
+	}
+}
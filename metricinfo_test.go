@@ -0,0 +1,104 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/trivago/tgo/tlog"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestMetricInfo(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+	defer mockMetric.Close()
+
+	mockMetric.NewWithInfo("messages", MetricInfo{MetricKindCounter, "messages", "Messages processed"})
+	mockMetric.NewWithInfo("queue", MetricInfo{Kind: MetricKindGauge})
+	mockMetric.New("plain")
+	expect.NoError(mockMetric.NewRate("messages", "messagesPerSec", time.Hour, 10, 0, true))
+
+	info, exists := mockMetric.GetInfo("messages")
+	expect.True(exists)
+	expect.Equal(MetricKindCounter, info.Kind)
+	expect.Equal("messages", info.Unit)
+
+	info, exists = mockMetric.GetInfo("messagesPerSec")
+	expect.True(exists)
+	expect.Equal(MetricKindRate, info.Kind)
+
+	_, exists = mockMetric.GetInfo("plain")
+	expect.False(exists)
+
+	expect.True(mockMetric.isCounter("messages"))
+	expect.False(mockMetric.isCounter("queue"))
+	expect.False(mockMetric.isCounter("plain"))
+	expect.False(mockMetric.isCounter(MetricGoRoutines))
+
+	data, err := mockMetric.DumpWithInfo()
+	expect.NoError(err)
+
+	values := make(map[string]map[string]interface{})
+	expect.NoError(json.Unmarshal(data, &values))
+	expect.MapEqual(values["messages"], "kind", "counter")
+	expect.MapEqual(values["messages"], "unit", "messages")
+	expect.MapEqual(values["messages"], "help", "Messages processed")
+	expect.MapEqual(values["messages"], "value", float64(0))
+	expect.MapEqual(values["messagesPerSec"], "kind", "rate")
+	expect.MapEqual(values["plain"], "kind", "untyped")
+	expect.MapNotSet(values["plain"], "unit")
+
+	buffer := new(bytes.Buffer)
+	expect.NoError(mockMetric.WritePrometheus(buffer))
+	expect.Contains(buffer.String(), "# HELP messages Messages processed (messages)\n# TYPE messages counter\n")
+	expect.Contains(buffer.String(), "# TYPE queue gauge\n")
+	expect.Contains(buffer.String(), "# TYPE plain untyped\n")
+	expect.Contains(buffer.String(), "# TYPE messagesPerSec gauge\n")
+}
+
+func TestMetricCounterWarnings(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	buffer := new(bytes.Buffer)
+	tlog.SetVerbosity(tlog.VerbosityWarning)
+	tlog.SetWriter(buffer)
+	defer tlog.SetWriter(os.Stderr)
+	defer tlog.SetVerbosity(tlog.VerbosityError)
+
+	mockMetric.NewWithInfo("counter", MetricInfo{Kind: MetricKindCounter})
+	mockMetric.NewWithInfo("gauge", MetricInfo{Kind: MetricKindGauge})
+
+	mockMetric.Set("counter", 10)
+	mockMetric.Sub("counter", 1)
+	expect.Equal(0, buffer.Len())
+
+	mockMetric.EnableCounterWarnings(true)
+	mockMetric.Sub("gauge", 1)
+	mockMetric.Set("counter", 20)
+	expect.Equal(0, buffer.Len())
+
+	mockMetric.Dec("counter")
+	expect.Contains(buffer.String(), "Counter counter has been decreased by 1")
+
+	buffer.Reset()
+	mockMetric.Set("counter", 5)
+	expect.Contains(buffer.String(), "Counter counter has been decreased by 14")
+}
@@ -0,0 +1,184 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/trivago/tgo/tio"
+	"github.com/trivago/tgo/tlog"
+)
+
+// MetricSnapshotVersion is the file format version written by SaveSnapshot.
+// Files with a different version are rejected by RestoreSnapshot.
+const MetricSnapshotVersion = 1
+
+// metricSnapshot is the file format used by SaveSnapshot
+type metricSnapshot struct {
+	Version   int                              `json:"version"`
+	Timestamp int64                            `json:"timestamp"`
+	Metrics   map[string]int64                 `json:"metrics,omitempty"`
+	Floats    map[string]float64               `json:"floats,omitempty"`
+	Vecs      map[string][]metricSnapshotLabel `json:"vecs,omitempty"`
+}
+
+type metricSnapshotLabel struct {
+	Labels []string `json:"labels"`
+	Value  int64    `json:"value"`
+}
+
+// Persist marks the given metrics to be written by SaveSnapshot and to be
+// restored by RestoreSnapshot. Integer and float metrics as well as labeled
+// metric families can be persisted. Rates, histograms and summaries are
+// ignored. Metrics may be marked before they are created.
+func (met *Metrics) Persist(names ...string) {
+	met.storeGuard.Lock()
+	for _, name := range names {
+		met.persistent[name] = true
+	}
+	met.storeGuard.Unlock()
+}
+
+// EnablePersistence restores all metrics marked by Persist from the given
+// file and writes a new snapshot to this file in the given interval as
+// well as on Close. An interval of 0 only writes the snapshot on Close.
+// A missing file is not treated as an error.
+// Metrics that are marked after calling this function are not restored but
+// are written with the next snapshot.
+func (met *Metrics) EnablePersistence(path string, interval time.Duration) error {
+	if err := met.RestoreSnapshot(path); err != nil && !os.IsNotExist(err) {
+		return err // ### return, invalid snapshot ###
+	}
+
+	met.rateGuard.Lock()
+	defer met.rateGuard.Unlock()
+
+	if met.persistTask != nil {
+		met.scheduler.Remove(met.persistTask)
+		met.persistTask = nil
+	}
+	met.persistPath = path
+
+	if interval <= 0 {
+		return nil // ### return, only persist on Close ###
+	}
+
+	met.startScheduler(nil)
+	task, err := met.scheduler.Add(interval, func() {
+		met.saveSnapshotLogged(path)
+	})
+	if err != nil {
+		return err
+	}
+	met.persistTask = task
+	return nil
+}
+
+// SaveSnapshot writes the current value of all metrics marked by Persist to
+// the given file. The file is replaced atomically, i.e. it is either written
+// completely or not at all.
+func (met *Metrics) SaveSnapshot(path string) error {
+	snapshot := metricSnapshot{
+		Version:   MetricSnapshotVersion,
+		Timestamp: time.Now().Unix(),
+		Metrics:   make(map[string]int64),
+		Floats:    make(map[string]float64),
+		Vecs:      make(map[string][]metricSnapshotLabel),
+	}
+
+	met.storeGuard.RLock()
+	for name := range met.persistent {
+		if value, exists := met.store[name]; exists {
+			snapshot.Metrics[name] = atomic.LoadInt64(value)
+		}
+		if value, exists := met.floats[name]; exists {
+			snapshot.Floats[name] = math.Float64frombits(atomic.LoadUint64(value))
+		}
+		if vec, exists := met.vecs[name]; exists {
+			for _, sample := range vec.snapshot() {
+				snapshot.Vecs[name] = append(snapshot.Vecs[name], metricSnapshotLabel{
+					Labels: sample.labelValues,
+					Value:  sample.value,
+				})
+			}
+		}
+	}
+	met.storeGuard.RUnlock()
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return tio.WriteFileAtomic(path, data, 0644)
+}
+
+// RestoreSnapshot sets all metrics marked by Persist to the values stored in
+// the given file. Metrics that are stored in the file but do not exist or
+// are not marked anymore are skipped. The same is true for label sets that
+// would exceed the cardinality limit of their metric family.
+// If the file does not exist, an error matching os.IsNotExist is returned.
+func (met *Metrics) RestoreSnapshot(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	snapshot := metricSnapshot{}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("Metric snapshot %s is invalid: %s", path, err)
+	}
+	if snapshot.Version != MetricSnapshotVersion {
+		return fmt.Errorf("Metric snapshot %s has unsupported version %d", path, snapshot.Version)
+	}
+
+	met.storeGuard.RLock()
+	defer met.storeGuard.RUnlock()
+
+	for name, value := range snapshot.Metrics {
+		if metric, exists := met.store[name]; exists && met.persistent[name] {
+			atomic.StoreInt64(metric, value)
+		}
+	}
+	for name, value := range snapshot.Floats {
+		if metric, exists := met.floats[name]; exists && met.persistent[name] {
+			atomic.StoreUint64(metric, math.Float64bits(value))
+		}
+	}
+	for name, labelSets := range snapshot.Vecs {
+		vec, exists := met.vecs[name]
+		if !exists || !met.persistent[name] {
+			continue // ### continue, unknown family ###
+		}
+		for _, labelSet := range labelSets {
+			if handle, err := vec.WithLabels(labelSet.Labels...); err == nil {
+				handle.Set(labelSet.Value)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (met *Metrics) saveSnapshotLogged(path string) {
+	if err := met.SaveSnapshot(path); err != nil {
+		tlog.Error.Printf("Failed to write metric snapshot %s: %s", path, err)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestMetricSnapshot(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "tgo")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "metrics.json")
+
+	mockMetric := getMockMetric()
+	mockMetric.New("total")
+	mockMetric.New("volatile")
+	mockMetric.NewFloat("seconds")
+	vec, err := mockMetric.NewVec("requests", 0, "code")
+	expect.NoError(err)
+	handle, err := vec.WithLabels("200")
+	expect.NoError(err)
+
+	mockMetric.Persist("total", "seconds", "requests", "removed")
+	mockMetric.Set("total", 42)
+	mockMetric.Set("volatile", 7)
+	mockMetric.SetFloat("seconds", 1.5)
+	handle.Set(3)
+
+	expect.NoError(mockMetric.SaveSnapshot(path))
+
+	// Metrics not existing anymore or not marked are skipped
+	restored := getMockMetric()
+	restored.New("total")
+	restored.New("volatile")
+	restored.NewFloat("seconds")
+	_, err = restored.NewVec("requests", 0, "code")
+	expect.NoError(err)
+	restored.Persist("total", "seconds", "requests", "volatile")
+
+	expect.NoError(restored.RestoreSnapshot(path))
+
+	value, err := restored.Get("total")
+	expect.NoError(err)
+	expect.Equal(int64(42), value)
+
+	value, err = restored.Get("volatile")
+	expect.NoError(err)
+	expect.Equal(int64(0), value)
+
+	floatValue, err := restored.GetFloat("seconds")
+	expect.NoError(err)
+	expect.Equal(1.5, floatValue)
+
+	handle, err = restored.GetVec("requests").WithLabels("200")
+	expect.NoError(err)
+	expect.Equal(int64(3), handle.Get())
+
+	_, err = restored.Get("removed")
+	expect.NotNil(err)
+
+	// Unsupported versions are rejected
+	expect.NoError(ioutil.WriteFile(path, []byte(`{"version":999,"metrics":{"total":1}}`), 0644))
+	expect.NotNil(restored.RestoreSnapshot(path))
+
+	value, err = restored.Get("total")
+	expect.NoError(err)
+	expect.Equal(int64(42), value)
+
+	err = restored.RestoreSnapshot(filepath.Join(dir, "missing.json"))
+	expect.True(os.IsNotExist(err))
+}
+
+func TestMetricPersistence(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "tgo")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "metrics.json")
+
+	mockMetric := getMockMetric()
+	mockMetric.New("total")
+	mockMetric.Persist("total")
+
+	// A missing file is not an error
+	expect.NoError(mockMetric.EnablePersistence(path, 10*time.Millisecond))
+	mockMetric.Set("total", 10)
+
+	expect.NonBlocking(time.Second, func() {
+		for {
+			if data, err := ioutil.ReadFile(path); err == nil && len(data) > 0 {
+				restored := getMockMetric()
+				restored.New("total")
+				restored.Persist("total")
+				if restored.RestoreSnapshot(path) == nil {
+					if value, _ := restored.Get("total"); value == 10 {
+						return
+					}
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+
+	// Close writes a final snapshot
+	mockMetric.Set("total", 20)
+	mockMetric.Close()
+
+	restored := getMockMetric()
+	restored.New("total")
+	restored.Persist("total")
+	expect.NoError(restored.EnablePersistence(path, 0))
+
+	value, err := restored.Get("total")
+	expect.NoError(err)
+	expect.Equal(int64(20), value)
+
+	expect.NoError(ioutil.WriteFile(path, []byte("{"), 0644))
+	expect.NotNil(restored.EnablePersistence(path, 0))
+}
@@ -0,0 +1,306 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// PrometheusContentType is the content type used by the prometheus text
+	// exposition format.
+	PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// PrometheusHandler is a http.Handler that writes all metrics and rates of
+// a Metrics store in the prometheus text exposition format.
+type PrometheusHandler struct {
+	metrics *Metrics
+}
+
+// NewPrometheusHandler creates a new http handler for the given metrics
+// store.
+func NewPrometheusHandler(m *Metrics) PrometheusHandler {
+	return PrometheusHandler{
+		metrics: m,
+	}
+}
+
+// ServeHTTP implements the http.Handler interface. Errors while writing the
+// response are logged.
+func (handler PrometheusHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", PrometheusContentType)
+	if err := handler.metrics.WritePrometheus(rw); err != nil {
+		log.Print("Metrics: ", err)
+	}
+}
+
+// WritePrometheus writes all metrics and rates to the given writer using the
+// prometheus text exposition format. Metric names are converted to valid
+// prometheus names, i.e. all invalid characters are replaced by "_".
+// If two metrics map to the same prometheus series, only the first one is
+// written and the collision is logged once. This includes the "_bucket",
+// "_sum" and "_count" series of histograms and summaries.
+// Rates are exported as gauges. Other metrics are exported as counters or
+// gauges if registered as such, or as untyped otherwise. Labeled metric families are written as one family
+// with one line per label set. Histograms and summaries are written using
+// the prometheus histogram and summary types.
+func (met *Metrics) WritePrometheus(writer io.Writer) error {
+	return met.WritePrometheusFiltered(writer, nil)
+}
+
+// WritePrometheusFiltered works like WritePrometheus but only writes metrics
+// whose name is accepted by the given filter.
+func (met *Metrics) WritePrometheusFiltered(writer io.Writer, filter MetricFilter) error {
+	out := bufio.NewWriter(writer)
+	written := make(map[string]string)
+
+	met.storeGuard.RLock()
+	metricNames := make([]string, 0, len(met.store)+len(met.floats))
+	metricValues := make(map[string]string, len(met.store)+len(met.floats))
+	for name, value := range met.store {
+		if !filter.accepts(name) {
+			continue
+		}
+		metricNames = append(metricNames, name)
+		metricValues[name] = strconv.FormatInt(atomic.LoadInt64(value), 10)
+	}
+	for name, value := range met.floats {
+		if !filter.accepts(name) {
+			continue
+		}
+		if _, exists := metricValues[name]; !exists {
+			metricNames = append(metricNames, name)
+			metricValues[name] = formatFloat(math.Float64frombits(atomic.LoadUint64(value)))
+		}
+	}
+	infos := make(map[string]MetricInfo, len(met.infos))
+	for name, info := range met.infos {
+		infos[name] = info
+	}
+	vecNames := make([]string, 0, len(met.vecs))
+	vecs := make(map[string]*MetricVec, len(met.vecs))
+	for name, vec := range met.vecs {
+		if !filter.accepts(name) {
+			continue
+		}
+		vecNames = append(vecNames, name)
+		vecs[name] = vec
+	}
+	histNames := make([]string, 0, len(met.histograms))
+	histograms := make(map[string]HistogramSnapshot, len(met.histograms))
+	for name, hist := range met.histograms {
+		if !filter.accepts(name) {
+			continue
+		}
+		histNames = append(histNames, name)
+		histograms[name] = hist.Snapshot()
+	}
+	summaryNames := make([]string, 0, len(met.summaries))
+	summaries := make(map[string]SummarySnapshot, len(met.summaries))
+	for name, summary := range met.summaries {
+		if !filter.accepts(name) {
+			continue
+		}
+		summaryNames = append(summaryNames, name)
+		summaries[name] = summary.Snapshot()
+	}
+	met.storeGuard.RUnlock()
+
+	met.rateGuard.RLock()
+	rateNames := make([]string, 0, len(met.rates))
+	rateValues := make(map[string]string, len(met.rates))
+	for name, rate := range met.rates {
+		if !filter.accepts(name) {
+			continue
+		}
+		rateNames = append(rateNames, name)
+		if rate.isFloat {
+			rateValues[name] = formatFloat(rate.get())
+		} else {
+			rateValues[name] = strconv.FormatInt(int64(rate.get()), 10)
+		}
+	}
+	met.rateGuard.RUnlock()
+
+	sort.Strings(metricNames)
+	sort.Strings(vecNames)
+	sort.Strings(histNames)
+	sort.Strings(summaryNames)
+	sort.Strings(rateNames)
+
+	for _, name := range metricNames {
+		if promName, ok := met.writePrometheusHeader(out, written, name, infos[name], "untyped"); ok {
+			out.WriteString(promName + " " + metricValues[name] + "\n")
+		}
+	}
+	for _, name := range vecNames {
+		vec := vecs[name]
+		if promName, ok := met.writePrometheusHeader(out, written, name, infos[name], "untyped"); ok {
+			for _, sample := range vec.snapshot() {
+				out.WriteString(promName + prometheusLabels(vec.labels, sample.labelValues) + " " + strconv.FormatInt(sample.value, 10) + "\n")
+			}
+		}
+	}
+	for _, name := range histNames {
+		hist := histograms[name]
+		if promName, ok := met.writePrometheusHeader(out, written, name, infos[name], "histogram"); ok {
+			for i, bound := range hist.Bounds {
+				out.WriteString(promName + "_bucket{le=\"" + formatFloat(bound) + "\"} " + strconv.FormatUint(hist.Buckets[i], 10) + "\n")
+			}
+			out.WriteString(promName + "_sum " + formatFloat(hist.Sum) + "\n")
+			out.WriteString(promName + "_count " + strconv.FormatUint(hist.Count, 10) + "\n")
+		}
+	}
+	for _, name := range summaryNames {
+		summary := summaries[name]
+		if promName, ok := met.writePrometheusHeader(out, written, name, infos[name], "summary"); ok {
+			for i, q := range summary.Quantiles {
+				out.WriteString(promName + "{quantile=\"" + formatFloat(q) + "\"} " + formatFloat(summary.Values[i]) + "\n")
+			}
+			out.WriteString(promName + "_sum " + formatFloat(summary.Sum) + "\n")
+			out.WriteString(promName + "_count " + strconv.FormatUint(summary.Count, 10) + "\n")
+		}
+	}
+	for _, name := range rateNames {
+		if promName, ok := met.writePrometheusHeader(out, written, name, infos[name], "gauge"); ok {
+			out.WriteString(promName + " " + rateValues[name] + "\n")
+		}
+	}
+
+	return out.Flush()
+}
+
+// writePrometheusHeader writes the HELP and TYPE lines of a metric family
+// and returns the prometheus name of the given metric. If any series of the
+// family has already been written, the collision is reported and false is
+// returned. The written map stores the original metric name for each
+// prometheus series name.
+// The registered metadata is used for the HELP line and, for counters and
+// gauges, for the TYPE line. Otherwise metricType is used.
+func (met *Metrics) writePrometheusHeader(out *bufio.Writer, written map[string]string, name string, info MetricInfo, metricType string) (string, bool) {
+	promName := prometheusName(name)
+	series := []string{promName}
+	switch metricType {
+	case "histogram":
+		series = append(series, promName+"_bucket", promName+"_sum", promName+"_count")
+	case "summary":
+		series = append(series, promName+"_sum", promName+"_count")
+	}
+
+	for _, seriesName := range series {
+		if other, exists := written[seriesName]; exists {
+			met.reportCollision(name, seriesName, other)
+			return promName, false // ### return, name collision ###
+		}
+	}
+	for _, seriesName := range series {
+		written[seriesName] = name
+	}
+
+	switch {
+	case metricType != "untyped":
+	case info.Kind == MetricKindCounter:
+		metricType = "counter"
+	case info.Kind == MetricKindGauge:
+		metricType = "gauge"
+	}
+
+	help := name
+	if info.Help != "" {
+		help = info.Help
+	}
+	if info.Unit != "" {
+		help += " (" + info.Unit + ")"
+	}
+
+	out.WriteString("# HELP " + promName + " " + prometheusEscape(help) + "\n")
+	out.WriteString("# TYPE " + promName + " " + metricType + "\n")
+	return promName, true
+}
+
+// reportCollision logs that the given metric is not exported as its
+// prometheus series name is already used by another metric. Each metric is
+// reported only once.
+func (met *Metrics) reportCollision(name string, seriesName string, other string) {
+	met.storeGuard.Lock()
+	reported := met.collisions[name]
+	met.collisions[name] = true
+	met.storeGuard.Unlock()
+
+	if !reported {
+		log.Printf("Metrics: %s is not exported as its prometheus name %s is already used by %s", name, seriesName, other)
+	}
+}
+
+// prometheusLabels formats a set of labels as {name="value",...}.
+func prometheusLabels(names []string, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	labels := bytes.NewBufferString("{")
+	for i, name := range names {
+		if i > 0 {
+			labels.WriteByte(',')
+		}
+		labels.WriteString(strings.Replace(prometheusName(name), ":", "_", -1))
+		labels.WriteString("=\"")
+		labels.WriteString(strings.Replace(prometheusEscape(values[i]), "\"", "\\\"", -1))
+		labels.WriteByte('"')
+	}
+	labels.WriteByte('}')
+	return labels.String()
+}
+
+// prometheusName converts a metric name to a valid prometheus metric name
+// by replacing all characters not matching [a-zA-Z0-9_:] by "_". Names
+// starting with a digit are prefixed with "_".
+func prometheusName(name string) string {
+	if len(name) == 0 {
+		return "_"
+	}
+
+	promName := []byte(name)
+	for i, c := range promName {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == ':':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			promName[i] = '_'
+		}
+	}
+
+	if name[0] >= '0' && name[0] <= '9' {
+		return "_" + name[:1] + string(promName[1:])
+	}
+	return string(promName)
+}
+
+// prometheusEscape escapes backslashes and newlines as required by HELP
+// lines.
+func prometheusEscape(text string) string {
+	text = strings.Replace(text, "\\", "\\\\", -1)
+	return strings.Replace(text, "\n", "\\n", -1)
+}
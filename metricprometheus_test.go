@@ -0,0 +1,139 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestPrometheusName(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	expect.Equal("Router_kafka_Messages", prometheusName("Router.kafka.Messages"))
+	expect.Equal("valid_name:sub", prometheusName("valid_name:sub"))
+	expect.Equal("_1abc", prometheusName("1abc"))
+	expect.Equal("a_b_c", prometheusName("a-b c"))
+	expect.Equal("_", prometheusName(""))
+}
+
+func TestWritePrometheus(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+	defer mockMetric.Close()
+
+	mockMetric.New("Router.kafka.Messages")
+	mockMetric.Set("Router.kafka.Messages", 42)
+	mockMetric.New("Router_kafka_Messages")
+	mockMetric.Set("Router_kafka_Messages", 1)
+	expect.NoError(mockMetric.NewRate("Router.kafka.Messages", "MessagesPerSec", time.Hour, 10, 0, false))
+
+	logBuffer := new(bytes.Buffer)
+	log.SetOutput(logBuffer)
+	defer log.SetOutput(os.Stderr)
+
+	buffer := new(bytes.Buffer)
+	expect.NoError(mockMetric.WritePrometheus(buffer))
+
+	expected := "# HELP Router_kafka_Messages Router.kafka.Messages\n" +
+		"# TYPE Router_kafka_Messages untyped\n" +
+		"Router_kafka_Messages 42\n" +
+		"# HELP MessagesPerSec MessagesPerSec\n" +
+		"# TYPE MessagesPerSec gauge\n" +
+		"MessagesPerSec 0\n"
+
+	expect.Equal(expected, buffer.String())
+	expect.Contains(logBuffer.String(), "Router_kafka_Messages is not exported as its prometheus name Router_kafka_Messages is already used by Router.kafka.Messages")
+}
+
+func TestWritePrometheusCollisions(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	mockMetric.New("latency.count")
+	mockMetric.Set("latency.count", 7)
+	_, err := mockMetric.NewHistogram("latency", 1)
+	expect.NoError(err)
+	summary, err := mockMetric.NewSummary("size", time.Minute)
+	expect.NoError(err)
+	summary.Observe(1)
+	mockMetric.NewFloat("size_sum")
+
+	logBuffer := new(bytes.Buffer)
+	log.SetOutput(logBuffer)
+	defer log.SetOutput(os.Stderr)
+
+	// Series of histograms and summaries collide with plain metrics
+	buffer := new(bytes.Buffer)
+	expect.NoError(mockMetric.WritePrometheus(buffer))
+	expect.Contains(buffer.String(), "latency_count 7\n")
+	expect.False(strings.Contains(buffer.String(), "latency_bucket"))
+	expect.Contains(buffer.String(), "size_sum 0\n")
+	expect.False(strings.Contains(buffer.String(), "size{quantile"))
+	expect.Contains(logBuffer.String(), "latency is not exported as its prometheus name latency_count is already used by latency.count")
+	expect.Contains(logBuffer.String(), "size is not exported as its prometheus name size_sum is already used by size_sum")
+
+	// Collisions are logged only once
+	logBuffer.Reset()
+	expect.NoError(mockMetric.WritePrometheus(new(bytes.Buffer)))
+	expect.Equal(0, logBuffer.Len())
+
+	// Collisions are logged again after the metric has been removed
+	mockMetric.Remove("latency")
+	_, err = mockMetric.NewHistogram("latency", 1)
+	expect.NoError(err)
+	expect.NoError(mockMetric.WritePrometheus(new(bytes.Buffer)))
+	expect.Contains(logBuffer.String(), "latency is not exported")
+	expect.False(strings.Contains(logBuffer.String(), "size is not exported"))
+}
+
+type failingResponseWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (rw failingResponseWriter) Write(data []byte) (int, error) {
+	return 0, fmt.Errorf("connection closed")
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	mockMetric.New("foo")
+	mockMetric.Set("foo", 7)
+
+	recorder := httptest.NewRecorder()
+	handler := NewPrometheusHandler(mockMetric)
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	expect.Equal(PrometheusContentType, recorder.Header().Get("Content-Type"))
+	expect.Contains(recorder.Body.String(), "foo 7\n")
+
+	// Write errors are logged
+	logBuffer := new(bytes.Buffer)
+	log.SetOutput(logBuffer)
+	defer log.SetOutput(os.Stderr)
+
+	handler.ServeHTTP(failingResponseWriter{httptest.NewRecorder()}, httptest.NewRequest("GET", "/metrics", nil))
+	expect.Contains(logBuffer.String(), "Metrics: connection closed")
+}
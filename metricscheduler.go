@@ -0,0 +1,207 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"container/heap"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// sampleScheduler executes tasks in individual intervals using a single go
+// routine. Tasks are stored in a heap ordered by their next execution time.
+// The go routine is started when the first task is added.
+type sampleScheduler struct {
+	guard   *sync.Mutex
+	tasks   scheduledTaskHeap
+	wakeup  chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	running bool
+}
+
+type scheduledTask struct {
+	interval time.Duration
+	next     time.Time
+	callback func()
+	index    int
+}
+
+func newSampleScheduler() *sampleScheduler {
+	return &sampleScheduler{
+		guard:  new(sync.Mutex),
+		tasks:  scheduledTaskHeap{},
+		wakeup: make(chan struct{}, 1),
+	}
+}
+
+// Add schedules callback to be called every interval. The first call happens
+// after one interval has passed. An error is returned if the interval is not
+// positive.
+func (sched *sampleScheduler) Add(interval time.Duration, callback func()) (*scheduledTask, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("Scheduled tasks require a positive interval, got %s", interval)
+	}
+
+	task := &scheduledTask{
+		interval: interval,
+		next:     time.Now().Add(interval),
+		callback: callback,
+	}
+
+	sched.guard.Lock()
+	heap.Push(&sched.tasks, task)
+	if !sched.running {
+		sched.running = true
+		sched.stop = make(chan struct{})
+		sched.done = make(chan struct{})
+		go sched.loop(sched.stop, sched.done)
+	}
+	sched.guard.Unlock()
+
+	sched.notify()
+	return task, nil
+}
+
+// Remove removes a task from the scheduler. If the task has already been
+// removed, nothing happens.
+func (sched *sampleScheduler) Remove(task *scheduledTask) {
+	sched.guard.Lock()
+	defer sched.guard.Unlock()
+
+	if task == nil || task.index < 0 || task.index >= len(sched.tasks) || sched.tasks[task.index] != task {
+		return // ### return, not scheduled ###
+	}
+	heap.Remove(&sched.tasks, task.index)
+}
+
+// IsRunning returns true if the scheduler go routine is active.
+func (sched *sampleScheduler) IsRunning() bool {
+	sched.guard.Lock()
+	defer sched.guard.Unlock()
+	return sched.running
+}
+
+// Stop stops the scheduler go routine and removes all tasks. This function
+// blocks until the go routine has ended.
+func (sched *sampleScheduler) Stop() {
+	sched.guard.Lock()
+	if !sched.running {
+		sched.guard.Unlock()
+		return // ### return, not running ###
+	}
+	sched.running = false
+	sched.tasks = scheduledTaskHeap{}
+	stop, done := sched.stop, sched.done
+	sched.guard.Unlock()
+
+	close(stop)
+	<-done
+}
+
+// notify wakes up the scheduler go routine so that it can recalculate the
+// time until the next task is due.
+func (sched *sampleScheduler) notify() {
+	select {
+	case sched.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (sched *sampleScheduler) loop(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		now := time.Now()
+		due := []*scheduledTask{}
+		wait := time.Hour
+
+		sched.guard.Lock()
+		for len(sched.tasks) > 0 {
+			task := sched.tasks[0]
+			if task.next.After(now) {
+				wait = task.next.Sub(now)
+				break
+			}
+			due = append(due, task)
+
+			// Skip missed intervals instead of executing them in a burst
+			task.next = task.next.Add(task.interval)
+			if !task.next.After(now) {
+				task.next = now.Add(task.interval)
+			}
+			heap.Fix(&sched.tasks, 0)
+		}
+		sched.guard.Unlock()
+
+		for _, task := range due {
+			task.callback()
+		}
+
+		if len(due) > 0 {
+			continue // ### continue, tasks might be due again ###
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-stop:
+			return // ### return, stopped ###
+		case <-sched.wakeup:
+		case <-timer.C:
+		}
+	}
+}
+
+type scheduledTaskHeap []*scheduledTask
+
+func (h scheduledTaskHeap) Len() int {
+	return len(h)
+}
+
+func (h scheduledTaskHeap) Less(i, j int) bool {
+	return h[i].next.Before(h[j].next)
+}
+
+func (h scheduledTaskHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *scheduledTaskHeap) Push(x interface{}) {
+	task := x.(*scheduledTask)
+	task.index = len(*h)
+	*h = append(*h, task)
+}
+
+func (h *scheduledTaskHeap) Pop() interface{} {
+	old := *h
+	task := old[len(old)-1]
+	old[len(old)-1] = nil
+	task.index = -1
+	*h = old[:len(old)-1]
+	return task
+}
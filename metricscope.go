@@ -0,0 +1,358 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"sync"
+	"time"
+)
+
+// MetricScope is a view on a Metrics store that prefixes all metric names
+// with a given namespace. All metrics, rates and sub-scopes created through
+// a scope are tracked and can be removed at once by calling Drop.
+// Metrics that existed before they were accessed through a scope are not
+// tracked and are not removed by Drop.
+type MetricScope struct {
+	metrics *Metrics
+	parent  *MetricScope
+	prefix  string
+	names   map[string]bool
+	rates   map[string]bool
+	scopes  []*MetricScope
+	guard   *sync.RWMutex
+}
+
+// Scope creates a new view on this metrics store. All names passed to the
+// scope are prefixed by prefix and a ".".
+func (met *Metrics) Scope(prefix string) *MetricScope {
+	return &MetricScope{
+		metrics: met,
+		prefix:  prefix + ".",
+		names:   make(map[string]bool),
+		rates:   make(map[string]bool),
+		guard:   new(sync.RWMutex),
+	}
+}
+
+// Scope creates a nested scope. The sub-scope is dropped when this scope is
+// dropped.
+func (scope *MetricScope) Scope(prefix string) *MetricScope {
+	subScope := scope.metrics.Scope(scope.prefix + prefix)
+	subScope.parent = scope
+	scope.attach(subScope)
+	return subScope
+}
+
+// Name returns the full name of a metric inside this scope.
+func (scope *MetricScope) Name(name string) string {
+	return scope.prefix + name
+}
+
+// Drop removes all metrics, rates and sub-scopes created through this scope.
+// A dropped sub-scope is detached from its parent scope until it is used to
+// create metrics again. The scope can still be used afterwards.
+func (scope *MetricScope) Drop() {
+	scope.guard.Lock()
+	names, rates, scopes := scope.names, scope.rates, scope.scopes
+	scope.names = make(map[string]bool)
+	scope.rates = make(map[string]bool)
+	scope.scopes = nil
+	scope.guard.Unlock()
+
+	if scope.parent != nil {
+		scope.parent.detach(scope)
+	}
+
+	for _, subScope := range scopes {
+		subScope.Drop()
+	}
+	for name := range rates {
+		scope.metrics.RemoveRate(name)
+	}
+	for name := range names {
+		scope.metrics.Remove(name)
+	}
+}
+
+// New is Metrics.New inside this scope
+func (scope *MetricScope) New(name string) {
+	scope.metrics.New(scope.track(name))
+}
+
+// NewFloat is Metrics.NewFloat inside this scope
+func (scope *MetricScope) NewFloat(name string) {
+	scope.metrics.NewFloat(scope.track(name))
+}
+
+// NewWithInfo is Metrics.NewWithInfo inside this scope
+func (scope *MetricScope) NewWithInfo(name string, info MetricInfo) {
+	scope.metrics.NewWithInfo(scope.track(name), info)
+}
+
+// Handle is Metrics.Handle inside this scope
+func (scope *MetricScope) Handle(name string) *MetricHandle {
+	return scope.metrics.Handle(scope.track(name))
+}
+
+// Counter is Metrics.Counter inside this scope
+func (scope *MetricScope) Counter(name string) *MetricHandle {
+	return scope.metrics.Counter(scope.track(name))
+}
+
+// Gauge is Metrics.Gauge inside this scope
+func (scope *MetricScope) Gauge(name string) *MetricHandle {
+	return scope.metrics.Gauge(scope.track(name))
+}
+
+// NewVec is Metrics.NewVec inside this scope
+func (scope *MetricScope) NewVec(name string, maxLabelSets int, labels ...string) (*MetricVec, error) {
+	fullName := scope.Name(name)
+	existed := scope.metrics.isRegistered(fullName)
+
+	vec, err := scope.metrics.NewVec(fullName, maxLabelSets, labels...)
+	if err == nil && !existed {
+		scope.trackCreated(fullName)
+	}
+	return vec, err
+}
+
+// NewHistogram is Metrics.NewHistogram inside this scope
+func (scope *MetricScope) NewHistogram(name string, buckets ...float64) (*Histogram, error) {
+	fullName := scope.Name(name)
+	existed := scope.metrics.isRegistered(fullName)
+
+	hist, err := scope.metrics.NewHistogram(fullName, buckets...)
+	if err == nil && !existed {
+		scope.trackCreated(fullName)
+	}
+	return hist, err
+}
+
+// NewSummary is Metrics.NewSummary inside this scope
+func (scope *MetricScope) NewSummary(name string, maxAge time.Duration, quantiles ...float64) (*Summary, error) {
+	fullName := scope.Name(name)
+	existed := scope.metrics.isRegistered(fullName)
+
+	summary, err := scope.metrics.NewSummary(fullName, maxAge, quantiles...)
+	if err == nil && !existed {
+		scope.trackCreated(fullName)
+	}
+	return summary, err
+}
+
+// NewRate is Metrics.NewRate inside this scope. Both, the base metric and the
+// rate name are prefixed.
+func (scope *MetricScope) NewRate(baseMetric string, name string, interval time.Duration, numSamples uint8, numMedianSamples uint8, relative bool) error {
+	err := scope.metrics.NewRate(scope.Name(baseMetric), scope.Name(name), interval, numSamples, numMedianSamples, relative)
+	if err == nil {
+		scope.trackRate(name)
+	}
+	return err
+}
+
+// NewEWMA is Metrics.NewEWMA inside this scope. Both, the base metric and the
+// rate name are prefixed.
+func (scope *MetricScope) NewEWMA(baseMetric string, name string, window time.Duration) error {
+	err := scope.metrics.NewEWMA(scope.Name(baseMetric), scope.Name(name), window)
+	if err == nil {
+		scope.trackRate(name)
+	}
+	return err
+}
+
+// Set is Metrics.Set inside this scope
+func (scope *MetricScope) Set(name string, value int64) {
+	scope.metrics.Set(scope.track(name), value)
+}
+
+// SetI is Metrics.SetI inside this scope
+func (scope *MetricScope) SetI(name string, value int) {
+	scope.metrics.SetI(scope.track(name), value)
+}
+
+// SetF is Metrics.SetF inside this scope
+func (scope *MetricScope) SetF(name string, value float64) {
+	scope.metrics.SetF(scope.track(name), value)
+}
+
+// SetB is Metrics.SetB inside this scope
+func (scope *MetricScope) SetB(name string, value bool) {
+	scope.metrics.SetB(scope.track(name), value)
+}
+
+// SetFloat is Metrics.SetFloat inside this scope
+func (scope *MetricScope) SetFloat(name string, value float64) {
+	scope.metrics.SetFloat(scope.track(name), value)
+}
+
+// Inc is Metrics.Inc inside this scope
+func (scope *MetricScope) Inc(name string) {
+	scope.metrics.Inc(scope.track(name))
+}
+
+// Dec is Metrics.Dec inside this scope
+func (scope *MetricScope) Dec(name string) {
+	scope.metrics.Dec(scope.track(name))
+}
+
+// Add is Metrics.Add inside this scope
+func (scope *MetricScope) Add(name string, value int64) {
+	scope.metrics.Add(scope.track(name), value)
+}
+
+// AddI is Metrics.AddI inside this scope
+func (scope *MetricScope) AddI(name string, value int) {
+	scope.metrics.AddI(scope.track(name), value)
+}
+
+// AddF is Metrics.AddF inside this scope
+func (scope *MetricScope) AddF(name string, value float64) {
+	scope.metrics.AddF(scope.track(name), value)
+}
+
+// AddFloat is Metrics.AddFloat inside this scope
+func (scope *MetricScope) AddFloat(name string, value float64) {
+	scope.metrics.AddFloat(scope.track(name), value)
+}
+
+// Sub is Metrics.Sub inside this scope
+func (scope *MetricScope) Sub(name string, value int64) {
+	scope.metrics.Sub(scope.track(name), value)
+}
+
+// SubI is Metrics.SubI inside this scope
+func (scope *MetricScope) SubI(name string, value int) {
+	scope.metrics.SubI(scope.track(name), value)
+}
+
+// SubF is Metrics.SubF inside this scope
+func (scope *MetricScope) SubF(name string, value float64) {
+	scope.metrics.SubF(scope.track(name), value)
+}
+
+// SubFloat is Metrics.SubFloat inside this scope
+func (scope *MetricScope) SubFloat(name string, value float64) {
+	scope.metrics.SubFloat(scope.track(name), value)
+}
+
+// Get is Metrics.Get inside this scope
+func (scope *MetricScope) Get(name string) (int64, error) {
+	return scope.metrics.Get(scope.Name(name))
+}
+
+// GetFloat is Metrics.GetFloat inside this scope
+func (scope *MetricScope) GetFloat(name string) (float64, error) {
+	return scope.metrics.GetFloat(scope.Name(name))
+}
+
+// Persist is Metrics.Persist inside this scope
+func (scope *MetricScope) Persist(names ...string) {
+	fullNames := make([]string, len(names))
+	for i, name := range names {
+		fullNames[i] = scope.Name(name)
+	}
+	scope.metrics.Persist(fullNames...)
+}
+
+// Remove is Metrics.Remove inside this scope
+func (scope *MetricScope) Remove(name string) {
+	fullName := scope.Name(name)
+	scope.guard.Lock()
+	delete(scope.names, fullName)
+	scope.guard.Unlock()
+
+	scope.metrics.Remove(fullName)
+}
+
+// RemoveRate is Metrics.RemoveRate inside this scope
+func (scope *MetricScope) RemoveRate(name string) {
+	fullName := scope.Name(name)
+	scope.guard.Lock()
+	delete(scope.rates, fullName)
+	scope.guard.Unlock()
+
+	scope.metrics.RemoveRate(fullName)
+}
+
+// track registers a metric as created by this scope if it does not exist
+// yet and returns the prefixed name.
+func (scope *MetricScope) track(name string) string {
+	fullName := scope.Name(name)
+
+	scope.guard.RLock()
+	tracked := scope.names[fullName]
+	scope.guard.RUnlock()
+
+	if !tracked && !scope.metrics.isRegistered(fullName) {
+		scope.trackCreated(fullName)
+	}
+	return fullName
+}
+
+// trackCreated registers a metric as created by this scope.
+func (scope *MetricScope) trackCreated(fullName string) {
+	scope.guard.Lock()
+	scope.names[fullName] = true
+	scope.guard.Unlock()
+
+	if scope.parent != nil {
+		scope.parent.attach(scope)
+	}
+}
+
+// trackRate registers a rate as created by this scope.
+func (scope *MetricScope) trackRate(name string) {
+	scope.guard.Lock()
+	scope.rates[scope.Name(name)] = true
+	scope.guard.Unlock()
+
+	if scope.parent != nil {
+		scope.parent.attach(scope)
+	}
+}
+
+// attach adds a sub-scope to this scope if it is not yet part of it.
+// This scope is attached to its own parent, too.
+func (scope *MetricScope) attach(subScope *MetricScope) {
+	scope.guard.Lock()
+	attached := false
+	for _, child := range scope.scopes {
+		if child == subScope {
+			attached = true
+			break
+		}
+	}
+	if !attached {
+		scope.scopes = append(scope.scopes, subScope)
+	}
+	scope.guard.Unlock()
+
+	if scope.parent != nil {
+		scope.parent.attach(scope)
+	}
+}
+
+// detach removes a sub-scope from this scope.
+func (scope *MetricScope) detach(subScope *MetricScope) {
+	scope.guard.Lock()
+	defer scope.guard.Unlock()
+
+	for i, child := range scope.scopes {
+		if child == subScope {
+			scope.scopes = append(scope.scopes[:i], scope.scopes[i+1:]...)
+			return // ### return, removed ###
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestMetricsRemove(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+	defer mockMetric.Close()
+
+	mockMetric.NewWithInfo("base", MetricInfo{Kind: MetricKindCounter})
+	mockMetric.NewFloat("float")
+	expect.NoError(mockMetric.NewRate("base", "rate", time.Hour, 10, 0, false))
+	expect.NoError(mockMetric.NewRate("float", "floatRate", time.Hour, 10, 0, false))
+	_, err := mockMetric.NewHistogram("hist")
+	expect.NoError(err)
+
+	mockMetric.RemoveRate("floatRate")
+	_, err = mockMetric.Get("floatRate")
+	expect.NotNil(err)
+	_, err = mockMetric.GetFloat("float")
+	expect.NoError(err)
+
+	// Removing a metric removes dependent rates
+	mockMetric.Remove("base")
+	_, err = mockMetric.Get("base")
+	expect.NotNil(err)
+	_, err = mockMetric.Get("rate")
+	expect.NotNil(err)
+	_, exists := mockMetric.GetInfo("base")
+	expect.False(exists)
+
+	mockMetric.Remove("hist")
+	expect.Nil(mockMetric.GetHistogram("hist"))
+
+	// Removing unknown metrics is a no-op
+	mockMetric.Remove("unknown")
+	mockMetric.RemoveRate("unknown")
+}
+
+func TestMetricScope(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+	defer mockMetric.Close()
+
+	mockMetric.New("consumer.kafka.foreign")
+
+	scope := mockMetric.Scope("consumer.kafka")
+	scope.New("messages")
+	scope.Inc("messages")
+	scope.SetFloat("lag", 1.5)
+	expect.NoError(scope.NewRate("messages", "messagesPerSec", time.Hour, 10, 0, true))
+	_, err := scope.NewVec("errors", 0, "type")
+	expect.NoError(err)
+
+	value, err := mockMetric.Get("consumer.kafka.messages")
+	expect.NoError(err)
+	expect.Equal(int64(1), value)
+
+	value, err = scope.Get("messages")
+	expect.NoError(err)
+	expect.Equal(int64(1), value)
+
+	_, err = mockMetric.Get("consumer.kafka.messagesPerSec")
+	expect.NoError(err)
+
+	subScope := scope.Scope("partition0")
+	subScope.Set("offset", 42)
+	value, err = mockMetric.Get("consumer.kafka.partition0.offset")
+	expect.NoError(err)
+	expect.Equal(int64(42), value)
+
+	// A rate that could not be created must not be removed on Drop
+	mockMetric.New("consumer.kafka.owned")
+	expect.NoError(mockMetric.NewRate("consumer.kafka.owned", "consumer.kafka.shared", time.Hour, 10, 0, true))
+	expect.NotNil(scope.NewRate("messages", "shared", time.Hour, 10, 0, true))
+
+	scope.Drop()
+
+	for _, name := range []string{
+		"consumer.kafka.messages",
+		"consumer.kafka.lag",
+		"consumer.kafka.messagesPerSec",
+		"consumer.kafka.partition0.offset",
+	} {
+		_, err = mockMetric.GetFloat(name)
+		expect.NotNil(err)
+	}
+	expect.Nil(mockMetric.GetVec("consumer.kafka.errors"))
+
+	_, err = mockMetric.Get("consumer.kafka.foreign")
+	expect.NoError(err)
+	_, err = mockMetric.Get("consumer.kafka.shared")
+	expect.NoError(err)
+}
+
+func TestMetricScopeTracking(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+	defer mockMetric.Close()
+
+	// Metrics created outside of the scope must survive Drop
+	mockMetric.New("consumer.kafka.existing")
+	_, err := mockMetric.NewVec("consumer.kafka.errors", 0, "type")
+	expect.NoError(err)
+
+	scope := mockMetric.Scope("consumer.kafka")
+	scope.Inc("existing")
+	_, err = scope.NewVec("errors", 0, "type")
+	expect.NoError(err)
+	scope.Drop()
+
+	value, err := mockMetric.Get("consumer.kafka.existing")
+	expect.NoError(err)
+	expect.Equal(int64(1), value)
+	expect.NotNil(mockMetric.GetVec("consumer.kafka.errors"))
+
+	// Dropped sub-scopes are removed from their parent
+	for i := 0; i < 10; i++ {
+		subScope := scope.Scope("partition")
+		subScope.Inc("offset")
+		subScope.Drop()
+	}
+	expect.Equal(0, len(scope.scopes))
+
+	// Sub-scopes used after Drop are dropped with their parent again
+	subScope := scope.Scope("partition")
+	subScope.Drop()
+	subScope.Inc("offset")
+	expect.Equal(1, len(scope.scopes))
+
+	scope.Drop()
+	_, err = mockMetric.Get("consumer.kafka.partition.offset")
+	expect.NotNil(err)
+	expect.Equal(0, len(scope.scopes))
+}
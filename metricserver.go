@@ -15,17 +15,26 @@
 package tgo
 
 import (
+	"context"
 	"log"
 	"net"
+	"net/http"
+	"sync"
 	"time"
 )
 
+// MetricServerShutdownTimeout defines how long Stop waits for active HTTP
+// requests to finish.
+const MetricServerShutdownTimeout = 5 * time.Second
+
 // MetricServer contains state information about the metric server process
 type MetricServer struct {
-	metrics *Metrics
-	running bool
-	listen  net.Listener
-	updates *time.Ticker
+	metrics    *Metrics
+	running    bool
+	listen     net.Listener
+	httpServer *http.Server
+	updates    *time.Ticker
+	guard      *sync.Mutex
 }
 
 // NewMetricServer creates a new server state for a metric server based on
@@ -35,6 +44,7 @@ func NewMetricServer() *MetricServer {
 		metrics: Metric,
 		running: false,
 		updates: time.NewTicker(time.Second),
+		guard:   new(sync.Mutex),
 	}
 }
 
@@ -45,6 +55,7 @@ func NewMetricServerFor(m *Metrics) *MetricServer {
 		metrics: m,
 		running: false,
 		updates: time.NewTicker(time.Second),
+		guard:   new(sync.Mutex),
 	}
 }
 
@@ -62,7 +73,7 @@ func (server *MetricServer) handleMetricRequest(conn net.Conn) {
 }
 
 func (server *MetricServer) sysUpdate() {
-	for server.running {
+	for server.isRunning() {
 		_, running := <-server.updates.C
 		if !running {
 			return // ### return, timer has been stopped ###
@@ -77,25 +88,14 @@ func (server *MetricServer) sysUpdate() {
 // returned and the connection is closed.
 // You can use the standard go notation for addresses like ":80".
 func (server *MetricServer) Start(address string) {
-	if server.running {
+	if !server.listenTo(address, server.Start) {
 		return
 	}
 
-	var err error
-	server.listen, err = net.Listen("tcp", address)
-	if err != nil {
-		log.Print("Metrics: ", err)
-		time.AfterFunc(time.Second*5, func() { server.Start(address) })
-		return
-	}
-
-	server.running = true
-	go server.sysUpdate()
-
-	for server.running {
+	for server.isRunning() {
 		client, err := server.listen.Accept()
 		if err != nil {
-			if server.running {
+			if server.isRunning() {
 				log.Print("Metrics: ", err)
 			}
 			return // ### break ###
@@ -105,12 +105,104 @@ func (server *MetricServer) Start(address string) {
 	}
 }
 
+// StartPrometheus causes a metric server to listen for HTTP requests on a
+// specific address and port. All requests are answered with the metrics in
+// the prometheus text exposition format.
+// You can use the standard go notation for addresses like ":80".
+func (server *MetricServer) StartPrometheus(address string) {
+	if !server.listenTo(address, server.StartPrometheus) {
+		return
+	}
+
+	server.serveHTTP(NewPrometheusHandler(server.metrics))
+}
+
+// StartHTTP causes a metric server to listen for HTTP requests on a specific
+// address and port. Metrics are served on the path "/metrics" using
+// MetricHandler, i.e. the format is chosen by the Accept header and
+// metrics can be filtered by the query parameters "prefix" and "regex".
+// You can use the standard go notation for addresses like ":80".
+func (server *MetricServer) StartHTTP(address string) {
+	if !server.listenTo(address, server.StartHTTP) {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", NewMetricHandler(server.metrics))
+	server.serveHTTP(mux)
+}
+
+// serveHTTP serves HTTP requests on the listening socket until the server
+// is stopped.
+func (server *MetricServer) serveHTTP(handler http.Handler) {
+	server.guard.Lock()
+	if !server.running {
+		server.guard.Unlock()
+		return // ### return, stopped before serving ###
+	}
+	httpServer := &http.Server{Handler: handler}
+	server.httpServer = httpServer
+	server.guard.Unlock()
+
+	err := httpServer.Serve(server.listen)
+	if err != nil && err != http.ErrServerClosed && server.isRunning() {
+		log.Print("Metrics: ", err)
+	}
+}
+
+func (server *MetricServer) isRunning() bool {
+	server.guard.Lock()
+	defer server.guard.Unlock()
+	return server.running
+}
+
+// listenTo opens the listening socket and starts the system metric updates.
+// If the socket cannot be opened, retry is called again after 5 seconds.
+// This function returns false if the server should not be started.
+func (server *MetricServer) listenTo(address string, retry func(string)) bool {
+	server.guard.Lock()
+	defer server.guard.Unlock()
+
+	if server.running {
+		return false
+	}
+
+	var err error
+	server.listen, err = net.Listen("tcp", address)
+	if err != nil {
+		log.Print("Metrics: ", err)
+		time.AfterFunc(time.Second*5, func() { retry(address) })
+		return false
+	}
+
+	server.running = true
+	go server.sysUpdate()
+	return true
+}
+
 // Stop notifies the metric server to halt.
+// HTTP servers wait up to MetricServerShutdownTimeout for active requests
+// to finish.
 func (server *MetricServer) Stop() {
+	server.guard.Lock()
 	server.running = false
+	listen, httpServer := server.listen, server.httpServer
+	server.httpServer = nil
+	server.guard.Unlock()
+
 	server.updates.Stop()
-	if server.listen != nil {
-		if err := server.listen.Close(); err != nil {
+
+	if httpServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), MetricServerShutdownTimeout)
+		defer cancel()
+		if err := httpServer.Shutdown(ctx); err != nil {
+			log.Print("Metrics: ", err)
+		}
+		return // ### return, listener closed by Shutdown ###
+	}
+
+	if listen != nil {
+		if err := listen.Close(); err != nil {
 			log.Print("Metrics: ", err)
 		}
 	}
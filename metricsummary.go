@@ -0,0 +1,440 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultSummaryAgeBuckets defines into how many buckets the maxAge of a
+	// summary is divided. Observations leave a summary in steps of
+	// maxAge/DefaultSummaryAgeBuckets.
+	DefaultSummaryAgeBuckets = 5
+
+	// summaryBufferSize is the number of observations collected lock-free
+	// before they are merged into the quantile streams.
+	summaryBufferSize = 512
+
+	// summaryBufferClosed is added to the index of a buffer that is merged so
+	// that no further observations are stored in it.
+	summaryBufferClosed = 1 << 62
+)
+
+// DefaultSummaryQuantiles are the quantiles reported by NewSummary if no
+// quantiles are given.
+var DefaultSummaryQuantiles = []float64{.5, .9, .99}
+
+// Summary estimates quantiles over the observations of a sliding time window
+// using the targeted quantiles algorithm by Cormode, Korn, Muthukrishnan and
+// Srivastava (CKMS). Memory usage does not depend on the number of
+// observations, but quantiles are only guaranteed to be accurate for the
+// quantiles given to NewSummary. The rank error of a quantile is 10% of its
+// distance to 0 or 1 but at least 0.001, e.g. 0.05 for the median and 0.001
+// for the 99th percentile. The minimum and maximum value are always exact.
+// Observing a value is lock-free. Observations are buffered and merged into
+// the estimator by the observer filling the buffer or when quantiles are
+// read. They leave the time window based on the time they were merged at.
+// Count and sum cover all observations.
+type Summary struct {
+	count     uint64
+	sum       uint64
+	buffer    atomic.Value // *summaryBuffer
+	quantiles []float64
+	streams   []*quantileStream
+	head      int
+	headEnd   time.Time
+	ageStep   time.Duration
+	guard     *sync.Mutex
+}
+
+// SummarySnapshot holds the state of a summary at a given point in time.
+// If no values have been observed, all quantile values are NaN.
+type SummarySnapshot struct {
+	Quantiles []float64
+	Values    []float64
+	Count     uint64
+	Sum       float64
+}
+
+// summaryBuffer collects observations of a Summary. Values and written flags
+// are stored in separate slices as 64-bit atomic operations require 8 byte
+// alignment on 32-bit platforms. A value is only read after its written flag
+// has been set.
+type summaryBuffer struct {
+	next    uint64
+	values  []uint64
+	written []uint32
+}
+
+// NewSummary creates a new summary estimating the given quantiles over the
+// observations of the last maxAge. If no quantiles are given,
+// DefaultSummaryQuantiles is used. Quantiles must be in the range [0,1] and
+// maxAge must be positive.
+// Registering a name that is already used by another metric fails.
+func (met *Metrics) NewSummary(name string, maxAge time.Duration, quantiles ...float64) (*Summary, error) {
+	if maxAge <= 0 {
+		return nil, fmt.Errorf("Summary %s requires a positive maxAge", name)
+	}
+	if len(quantiles) == 0 {
+		quantiles = DefaultSummaryQuantiles
+	}
+	for _, q := range quantiles {
+		if q < 0 || q > 1 {
+			return nil, fmt.Errorf("Summary %s has invalid quantile %v", name, q)
+		}
+	}
+
+	met.storeGuard.Lock()
+	defer met.storeGuard.Unlock()
+
+	if err := met.checkUnused(name); err != nil {
+		return nil, err
+	}
+
+	summary := newSummary(maxAge, quantiles, time.Now())
+	met.summaries[name] = summary
+	return summary, nil
+}
+
+func newSummary(maxAge time.Duration, quantiles []float64, now time.Time) *Summary {
+	summary := &Summary{
+		quantiles: append([]float64(nil), quantiles...),
+		streams:   make([]*quantileStream, DefaultSummaryAgeBuckets),
+		ageStep:   maxAge / DefaultSummaryAgeBuckets,
+		guard:     new(sync.Mutex),
+	}
+	sort.Float64s(summary.quantiles)
+
+	for i := range summary.streams {
+		summary.streams[i] = newQuantileStream(summary.quantiles)
+	}
+	summary.headEnd = now.Add(summary.ageStep)
+	summary.buffer.Store(newSummaryBuffer())
+	return summary
+}
+
+// GetSummary returns the summary registered under the given name.
+// If no such summary exists, nil is returned.
+func (met *Metrics) GetSummary(name string) *Summary {
+	met.storeGuard.RLock()
+	defer met.storeGuard.RUnlock()
+	return met.summaries[name]
+}
+
+// Observe adds a value to the summary.
+func (summary *Summary) Observe(value float64) {
+	atomic.AddUint64(&summary.count, 1)
+	atomicAddFloat64(&summary.sum, value)
+
+	for {
+		buffer := summary.buffer.Load().(*summaryBuffer)
+		if buffer.add(value) {
+			return // ### return, stored ###
+		}
+		summary.flushFull(buffer)
+	}
+}
+
+// Quantile estimates the given quantile over the current time window.
+// Only the quantiles passed to NewSummary are guaranteed to be accurate.
+// If no values have been observed, NaN is returned.
+func (summary *Summary) Quantile(q float64) float64 {
+	summary.guard.Lock()
+	defer summary.guard.Unlock()
+
+	summary.flush(time.Now())
+	return summary.streams[summary.head].query(q)
+}
+
+// Snapshot returns the current state of the summary.
+func (summary *Summary) Snapshot() SummarySnapshot {
+	return summary.snapshot(time.Now())
+}
+
+func (summary *Summary) snapshot(now time.Time) SummarySnapshot {
+	summary.guard.Lock()
+	defer summary.guard.Unlock()
+
+	summary.flush(now)
+	head := summary.streams[summary.head]
+	snapshot := SummarySnapshot{
+		Quantiles: append([]float64(nil), summary.quantiles...),
+		Values:    make([]float64, len(summary.quantiles)),
+		Count:     atomic.LoadUint64(&summary.count),
+		Sum:       math.Float64frombits(atomic.LoadUint64(&summary.sum)),
+	}
+
+	for i, q := range summary.quantiles {
+		snapshot.Values[i] = head.query(q)
+	}
+	return snapshot
+}
+
+// flushFull merges the given buffer into the streams if it is still the
+// active buffer. Otherwise it has already been merged by another go routine.
+func (summary *Summary) flushFull(buffer *summaryBuffer) {
+	summary.guard.Lock()
+	defer summary.guard.Unlock()
+
+	if summary.buffer.Load().(*summaryBuffer) == buffer {
+		summary.flush(time.Now())
+	}
+}
+
+// flush replaces the active buffer and merges the old one into all streams.
+// Streams older than maxAge are reset before. The guard has to be locked
+// when calling this function.
+func (summary *Summary) flush(now time.Time) {
+	buffer := summary.buffer.Load().(*summaryBuffer)
+	summary.buffer.Store(newSummaryBuffer())
+	values := buffer.close()
+
+	// The head stream holds the observations of the last maxAge. Once its
+	// age step has passed, it is reset and the next stream becomes head.
+	for !now.Before(summary.headEnd) {
+		summary.streams[summary.head].reset()
+		summary.head = (summary.head + 1) % len(summary.streams)
+		summary.headEnd = summary.headEnd.Add(summary.ageStep)
+	}
+
+	if len(values) == 0 {
+		return // ### return, nothing observed ###
+	}
+	sort.Float64s(values)
+	for _, stream := range summary.streams {
+		stream.merge(values)
+	}
+}
+
+func (summary *Summary) reset() {
+	summary.guard.Lock()
+	defer summary.guard.Unlock()
+
+	summary.buffer.Store(newSummaryBuffer())
+	for _, stream := range summary.streams {
+		stream.reset()
+	}
+	atomic.StoreUint64(&summary.count, 0)
+	atomic.StoreUint64(&summary.sum, 0)
+}
+
+func newSummaryBuffer() *summaryBuffer {
+	return &summaryBuffer{
+		values:  make([]uint64, summaryBufferSize),
+		written: make([]uint32, summaryBufferSize),
+	}
+}
+
+// add stores a value in the buffer. False is returned if the buffer is full
+// or has been closed.
+func (buffer *summaryBuffer) add(value float64) bool {
+	idx := atomic.AddUint64(&buffer.next, 1) - 1
+	if idx >= uint64(len(buffer.values)) {
+		return false // ### return, full ###
+	}
+	atomic.StoreUint64(&buffer.values[idx], math.Float64bits(value))
+	atomic.StoreUint32(&buffer.written[idx], 1)
+	return true
+}
+
+// close prevents further values from being added and returns the values
+// stored so far. Values that are currently being added are awaited.
+func (buffer *summaryBuffer) close() []float64 {
+	numValues := atomic.AddUint64(&buffer.next, summaryBufferClosed) - summaryBufferClosed
+	if numValues > uint64(len(buffer.values)) {
+		numValues = uint64(len(buffer.values))
+	}
+
+	values := make([]float64, numValues)
+	for i := range values {
+		for atomic.LoadUint32(&buffer.written[i]) == 0 {
+			runtime.Gosched()
+		}
+		values[i] = math.Float64frombits(atomic.LoadUint64(&buffer.values[i]))
+	}
+	return values
+}
+
+// dumpValue returns a JSON friendly representation of the summary state.
+// NaN values are stored as nil as JSON does not support NaN.
+func (snapshot SummarySnapshot) dumpValue() map[string]interface{} {
+	quantiles := make(map[string]interface{}, len(snapshot.Quantiles))
+	for i, q := range snapshot.Quantiles {
+		if math.IsNaN(snapshot.Values[i]) {
+			quantiles[formatFloat(q)] = nil
+		} else {
+			quantiles[formatFloat(q)] = snapshot.Values[i]
+		}
+	}
+
+	return map[string]interface{}{
+		"count":     snapshot.Count,
+		"sum":       snapshot.Sum,
+		"quantiles": quantiles,
+	}
+}
+
+// quantileStream is a CKMS targeted quantiles estimator. It keeps a sorted
+// list of samples, each representing width observations with a rank
+// uncertainty of delta. Samples are merged as long as the error stays within
+// the bounds required by the targeted quantiles.
+type quantileStream struct {
+	targets []quantileTarget
+	samples []quantileSample
+	count   float64
+}
+
+type quantileTarget struct {
+	quantile float64
+	epsilon  float64
+}
+
+type quantileSample struct {
+	value float64
+	width float64
+	delta float64
+}
+
+// summaryEpsilon returns the allowed rank error of the given quantile. The
+// error is 10% of the distance to 0 or 1, but at least 0.001.
+func summaryEpsilon(q float64) float64 {
+	return math.Max(0.1*math.Min(q, 1-q), 0.001)
+}
+
+func newQuantileStream(quantiles []float64) *quantileStream {
+	stream := &quantileStream{
+		targets: make([]quantileTarget, 0, len(quantiles)),
+	}
+	for _, q := range quantiles {
+		// 0 and 1 are served by the exact minimum and maximum
+		if q > 0 && q < 1 {
+			stream.targets = append(stream.targets, quantileTarget{q, summaryEpsilon(q)})
+		}
+	}
+	return stream
+}
+
+// allowedError returns the maximum width plus delta of a sample at the given
+// rank for which all targeted quantiles stay within their error bounds.
+func (stream *quantileStream) allowedError(rank float64) float64 {
+	allowed := math.MaxFloat64
+	for _, target := range stream.targets {
+		var err float64
+		if rank >= target.quantile*stream.count {
+			err = 2 * target.epsilon * rank / target.quantile
+		} else {
+			err = 2 * target.epsilon * (stream.count - rank) / (1 - target.quantile)
+		}
+		if err < allowed {
+			allowed = err
+		}
+	}
+	return allowed
+}
+
+// merge adds the given sorted values to the stream and compresses it.
+func (stream *quantileStream) merge(values []float64) {
+	rank := 0.0
+	idx := 0
+	for _, value := range values {
+		for idx < len(stream.samples) && stream.samples[idx].value <= value {
+			rank += stream.samples[idx].width
+			idx++
+		}
+
+		// New minimum and maximum values are exact
+		delta := 0.0
+		if idx > 0 && idx < len(stream.samples) {
+			delta = math.Max(math.Floor(stream.allowedError(rank))-1, 0)
+		}
+
+		stream.samples = append(stream.samples, quantileSample{})
+		copy(stream.samples[idx+1:], stream.samples[idx:])
+		stream.samples[idx] = quantileSample{value: value, width: 1, delta: delta}
+
+		stream.count++
+		rank++
+		idx++
+	}
+	stream.compress()
+}
+
+// compress merges samples while their combined error stays within bounds.
+// The first and the last sample are never merged away, so that the minimum
+// and maximum are kept.
+func (stream *quantileStream) compress() {
+	if len(stream.samples) < 3 {
+		return // ### return, nothing to compress ###
+	}
+
+	last := len(stream.samples) - 1
+	next := stream.samples[last]
+	nextIdx := last
+	rank := stream.count - 1 - next.width
+
+	for i := last - 1; i >= 1; i-- {
+		sample := stream.samples[i]
+		if sample.width+next.width+next.delta <= stream.allowedError(rank) {
+			next.width += sample.width
+			stream.samples[nextIdx] = next
+			copy(stream.samples[i:], stream.samples[i+1:])
+			stream.samples = stream.samples[:len(stream.samples)-1]
+			nextIdx--
+		} else {
+			next = sample
+			nextIdx = i
+		}
+		rank -= sample.width
+	}
+}
+
+// query returns the estimated value of the given quantile. If the stream is
+// empty, NaN is returned.
+func (stream *quantileStream) query(q float64) float64 {
+	switch {
+	case len(stream.samples) == 0:
+		return math.NaN()
+	case q <= 0:
+		return stream.samples[0].value
+	case q >= 1:
+		return stream.samples[len(stream.samples)-1].value
+	}
+
+	target := math.Ceil(q * stream.count)
+	target += math.Ceil(stream.allowedError(target) / 2)
+
+	prev := stream.samples[0]
+	rank := 0.0
+	for _, sample := range stream.samples[1:] {
+		rank += prev.width
+		if rank+sample.width+sample.delta > target {
+			return prev.value
+		}
+		prev = sample
+	}
+	return prev.value
+}
+
+func (stream *quantileStream) reset() {
+	stream.samples = stream.samples[:0]
+	stream.count = 0
+}
@@ -0,0 +1,148 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestSummary(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	_, err := mockMetric.NewSummary("invalid", 0)
+	expect.NotNil(err)
+	_, err = mockMetric.NewSummary("invalid", time.Minute, 1.5)
+	expect.NotNil(err)
+
+	summary, err := mockMetric.NewSummary("latency", time.Minute, 0, 0.5, 0.9, 0.99, 1)
+	expect.NoError(err)
+	expect.True(math.IsNaN(summary.Quantile(0.5)))
+
+	const numValues = 10000
+	random := rand.New(rand.NewSource(1))
+	for _, value := range random.Perm(numValues) {
+		summary.Observe(float64(value + 1))
+	}
+
+	// Values equal their rank, so the rank error can be checked directly
+	snapshot := summary.Snapshot()
+	expect.Equal(uint64(numValues), snapshot.Count)
+	expect.Equal(float64(numValues*(numValues+1)/2), snapshot.Sum)
+	for i, q := range snapshot.Quantiles {
+		maxError := summaryEpsilon(q) * numValues
+		expect.Geq(snapshot.Values[i], q*numValues-maxError)
+		expect.Leq(snapshot.Values[i], q*numValues+maxError+1)
+	}
+	expect.Equal(1.0, summary.Quantile(0))
+	expect.Equal(float64(numValues), summary.Quantile(1))
+
+	// Memory does not grow with the number of observations
+	expect.Less(len(summary.streams[summary.head].samples), numValues/10)
+
+	data, err := mockMetric.Dump()
+	expect.NoError(err)
+
+	values := make(map[string]struct {
+		Count     uint64
+		Sum       float64
+		Quantiles map[string]float64
+	})
+	expect.NoError(json.Unmarshal(data, &values))
+	expect.MapSet(values, "latency")
+	expect.Equal(uint64(numValues), values["latency"].Count)
+	expect.MapEqual(values["latency"].Quantiles, "1", float64(numValues))
+
+	buffer := new(bytes.Buffer)
+	expect.NoError(mockMetric.WritePrometheus(buffer))
+	expect.Contains(buffer.String(), "latency{quantile=\"1\"} 10000\n")
+	expect.Contains(buffer.String(), "latency_count 10000\n")
+
+	mockMetric.ResetMetrics()
+	expect.True(math.IsNaN(summary.Quantile(0.5)))
+	expect.Equal(uint64(0), summary.Snapshot().Count)
+}
+
+func TestSummaryMaxAge(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	start := time.Now()
+	summary, err := mockMetric.NewSummary("latency", time.Minute, 0.5)
+	expect.NoError(err)
+
+	// Buffered observations are assigned to the time they are merged at
+	for i := 0; i < 100; i++ {
+		summary.Observe(100)
+	}
+	summary.snapshot(start)
+	expect.Equal(100.0, summary.snapshot(start.Add(30 * time.Second)).Values[0])
+
+	// Observations leave the summary after maxAge
+	for i := 0; i < 100; i++ {
+		summary.Observe(1)
+	}
+	snapshot := summary.snapshot(start.Add(61 * time.Second))
+	expect.Equal(1.0, snapshot.Values[0])
+	expect.Equal(uint64(200), snapshot.Count)
+
+	snapshot = summary.snapshot(start.Add(5 * time.Minute))
+	expect.True(math.IsNaN(snapshot.Values[0]))
+	expect.Equal(uint64(200), snapshot.Count)
+}
+
+func TestSummaryConcurrentObserve(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	summary, err := mockMetric.NewSummary("latency", time.Hour)
+	expect.NoError(err)
+
+	const numWriters, numValues = 8, 5000
+	waitGroup := new(sync.WaitGroup)
+	for w := 0; w < numWriters; w++ {
+		waitGroup.Add(1)
+		go func(w int) {
+			defer waitGroup.Done()
+			for i := 0; i < numValues; i++ {
+				summary.Observe(float64(w*numValues + i))
+			}
+		}(w)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			summary.Snapshot()
+		}
+	}()
+	waitGroup.Wait()
+	<-done
+
+	// No observation is lost when buffers are merged
+	snapshot := summary.Snapshot()
+	expect.Equal(uint64(numWriters*numValues), snapshot.Count)
+	expect.Equal(float64(numWriters*numValues), summary.streams[summary.head].count)
+	expect.Equal(float64(numWriters*numValues-1), summary.Quantile(1))
+}
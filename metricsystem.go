@@ -0,0 +1,154 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"sync/atomic"
+	"time"
+)
+
+// SystemMetricGroup defines a set of system metrics that can be registered
+// and updated together. Groups can be combined using "|".
+type SystemMetricGroup uint32
+
+const (
+	// SystemMetricsRuntime contains the process start time, the go version,
+	// the number of go routines and the number of OS threads.
+	SystemMetricsRuntime = SystemMetricGroup(1 << iota)
+	// SystemMetricsMemory contains allocation and heap statistics. Updating
+	// this group requires runtime.ReadMemStats, which stops the world.
+	SystemMetricsMemory = SystemMetricGroup(1 << iota)
+	// SystemMetricsGC contains the number of garbage collections and pause
+	// time percentiles.
+	SystemMetricsGC = SystemMetricGroup(1 << iota)
+	// SystemMetricsProcess contains the consumed CPU time and the number of
+	// open file descriptors. Not all values are available on all platforms.
+	SystemMetricsProcess = SystemMetricGroup(1 << iota)
+	// SystemMetricsAll contains all system metric groups.
+	SystemMetricsAll = SystemMetricsRuntime | SystemMetricsMemory | SystemMetricsGC | SystemMetricsProcess
+)
+
+// InitSystemMetricGroups adds the given groups of system metrics to this
+// metric storage. System metrics need to be updated manually by calling
+// UpdateSystemMetrics(), which only updates the registered groups.
+// Calling this function again replaces the set of updated groups.
+func (met *Metrics) InitSystemMetricGroups(groups SystemMetricGroup) {
+	gauge := func(unit, help string) MetricInfo {
+		return MetricInfo{Kind: MetricKindGauge, Unit: unit, Help: help}
+	}
+	counter := func(unit, help string) MetricInfo {
+		return MetricInfo{Kind: MetricKindCounter, Unit: unit, Help: help}
+	}
+
+	if groups&SystemMetricsRuntime != 0 {
+		met.NewWithInfo(MetricProcessStart, gauge("seconds", "Unix time of the process start"))
+		met.NewWithInfo(MetricGoRoutines, gauge("", "Number of active go routines"))
+		met.NewWithInfo(MetricGoVersion, gauge("", "Go version as Major*10000+Minor*100+Patch"))
+		met.NewWithInfo(MetricProcessThreads, gauge("", "Number of OS threads"))
+		met.Set(MetricProcessStart, ProcessStartTime.Unix())
+		met.SetI(MetricGoVersion, goVersion())
+	}
+
+	if groups&SystemMetricsMemory != 0 {
+		met.NewWithInfo(MetricMemoryAllocated, gauge("bytes", "Currently allocated heap memory"))
+		met.NewWithInfo(MetricMemoryNumObjects, gauge("", "Number of allocated heap objects"))
+		met.NewWithInfo(MetricMemoryGCEnabled, gauge("", "1 if garbage collection is enabled"))
+		met.NewWithInfo(MetricMemoryHeapInUse, gauge("bytes", "Heap memory in in-use spans"))
+		met.NewWithInfo(MetricMemoryHeapIdle, gauge("bytes", "Heap memory in idle spans"))
+		met.NewWithInfo(MetricMemoryHeapReleased, gauge("bytes", "Heap memory returned to the OS"))
+		met.NewWithInfo(MetricMemoryStackInUse, gauge("bytes", "Stack memory in use"))
+		met.NewWithInfo(MetricMemoryTotalAllocated, counter("bytes", "Total heap memory allocated"))
+	}
+
+	if groups&SystemMetricsGC != 0 {
+		met.NewWithInfo(MetricGCNum, counter("", "Number of completed garbage collections"))
+		met.NewWithInfo(MetricGCPause50, gauge("nanoseconds", "Median garbage collection pause"))
+		met.NewWithInfo(MetricGCPause90, gauge("nanoseconds", "90th percentile of garbage collection pauses"))
+		met.NewWithInfo(MetricGCPause99, gauge("nanoseconds", "99th percentile of garbage collection pauses"))
+		met.NewWithInfo(MetricGCPauseMax, gauge("nanoseconds", "Longest garbage collection pause"))
+	}
+
+	if groups&SystemMetricsProcess != 0 {
+		met.NewFloat(MetricProcessCPUSeconds)
+		met.SetInfo(MetricProcessCPUSeconds, counter("seconds", "Consumed user and system CPU time"))
+		met.NewWithInfo(MetricProcessOpenFiles, gauge("", "Number of open file descriptors"))
+	}
+
+	atomic.StoreUint32(&met.systemGroups, uint32(groups))
+	met.UpdateSystemMetrics()
+}
+
+// UpdateSystemMetrics updates all default or system based metrics like memory
+// consumption and number of go routines. This function is not called
+// automatically.
+// Only groups registered by InitSystemMetricGroups are updated. If no groups
+// have been registered, SystemMetricsRuntime and SystemMetricsMemory are
+// updated.
+func (met *Metrics) UpdateSystemMetrics() {
+	groups := SystemMetricGroup(atomic.LoadUint32(&met.systemGroups))
+	if groups == 0 {
+		groups = SystemMetricsRuntime | SystemMetricsMemory
+	}
+
+	if groups&SystemMetricsRuntime != 0 {
+		met.SetI(MetricGoRoutines, runtime.NumGoroutine())
+		met.SetI(MetricProcessThreads, processThreads())
+	}
+
+	if groups&SystemMetricsMemory != 0 {
+		stats := new(runtime.MemStats)
+		runtime.ReadMemStats(stats)
+
+		met.Set(MetricMemoryAllocated, int64(stats.Alloc))
+		met.SetB(MetricMemoryGCEnabled, stats.EnableGC)
+		met.Set(MetricMemoryNumObjects, int64(stats.HeapObjects))
+		met.Set(MetricMemoryHeapInUse, int64(stats.HeapInuse))
+		met.Set(MetricMemoryHeapIdle, int64(stats.HeapIdle))
+		met.Set(MetricMemoryHeapReleased, int64(stats.HeapReleased))
+		met.Set(MetricMemoryStackInUse, int64(stats.StackInuse))
+		met.Set(MetricMemoryTotalAllocated, int64(stats.TotalAlloc))
+	}
+
+	if groups&SystemMetricsGC != 0 {
+		// 101 quantiles result in min, 1st, ..., 99th percentile, max
+		stats := &debug.GCStats{PauseQuantiles: make([]time.Duration, 101)}
+		debug.ReadGCStats(stats)
+
+		met.Set(MetricGCNum, stats.NumGC)
+		met.Set(MetricGCPause50, int64(stats.PauseQuantiles[50]))
+		met.Set(MetricGCPause90, int64(stats.PauseQuantiles[90]))
+		met.Set(MetricGCPause99, int64(stats.PauseQuantiles[99]))
+		met.Set(MetricGCPauseMax, int64(stats.PauseQuantiles[100]))
+	}
+
+	if groups&SystemMetricsProcess != 0 {
+		if seconds, ok := processCPUSeconds(); ok {
+			met.SetFloat(MetricProcessCPUSeconds, seconds)
+		}
+		if numFiles, ok := processOpenFiles(); ok {
+			met.SetI(MetricProcessOpenFiles, numFiles)
+		}
+	}
+}
+
+// threadCreateCount returns the number of OS threads created by the go
+// runtime. This is used on platforms where the current number of threads
+// cannot be queried.
+func threadCreateCount() int {
+	return pprof.Lookup("threadcreate").Count()
+}
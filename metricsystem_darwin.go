@@ -0,0 +1,34 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build darwin
+
+package tgo
+
+import (
+	"io/ioutil"
+)
+
+func processOpenFiles() (int, bool) {
+	files, err := ioutil.ReadDir("/dev/fd")
+	if err != nil {
+		return 0, false
+	}
+	// Reading the directory opens an additional descriptor
+	return len(files) - 1, true
+}
+
+func processThreads() int {
+	return threadCreateCount()
+}
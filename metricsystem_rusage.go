@@ -0,0 +1,32 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build linux darwin freebsd
+
+package tgo
+
+import (
+	"syscall"
+)
+
+// processCPUSeconds returns the user and system CPU time consumed by this
+// process in seconds.
+func processCPUSeconds() (float64, bool) {
+	usage := new(syscall.Rusage)
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, usage); err != nil {
+		return 0, false
+	}
+	cpuTime := usage.Utime.Nano() + usage.Stime.Nano()
+	return float64(cpuTime) / 1e9, true
+}
@@ -0,0 +1,80 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestSystemMetricGroups(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	mockMetric.InitSystemMetricGroups(SystemMetricsRuntime | SystemMetricsGC)
+
+	routines, err := mockMetric.Get(MetricGoRoutines)
+	expect.NoError(err)
+	expect.Greater(routines, int64(0))
+
+	threads, err := mockMetric.Get(MetricProcessThreads)
+	expect.NoError(err)
+	expect.Greater(threads, int64(0))
+
+	_, err = mockMetric.Get(MetricGCNum)
+	expect.NoError(err)
+
+	// Groups not registered must not be created by UpdateSystemMetrics
+	mockMetric.UpdateSystemMetrics()
+	_, err = mockMetric.Get(MetricMemoryAllocated)
+	expect.NotNil(err)
+	_, err = mockMetric.GetFloat(MetricProcessCPUSeconds)
+	expect.NotNil(err)
+
+	info, exists := mockMetric.GetInfo(MetricGCNum)
+	expect.True(exists)
+	expect.Equal(MetricKindCounter, info.Kind)
+}
+
+func TestSystemMetricsAll(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	runtime.GC()
+	mockMetric.InitSystemMetrics()
+
+	allocated, err := mockMetric.Get(MetricMemoryTotalAllocated)
+	expect.NoError(err)
+	expect.Greater(allocated, int64(0))
+
+	numGC, err := mockMetric.Get(MetricGCNum)
+	expect.NoError(err)
+	expect.Greater(numGC, int64(0))
+
+	version, err := mockMetric.Get(MetricGoVersion)
+	expect.NoError(err)
+	expect.Equal(int64(goVersion()), version)
+
+	_, err = mockMetric.GetFloat(MetricProcessCPUSeconds)
+	expect.NoError(err)
+
+	if runtime.GOOS == "linux" {
+		files, err := mockMetric.Get(MetricProcessOpenFiles)
+		expect.NoError(err)
+		expect.Greater(files, int64(0))
+	}
+}
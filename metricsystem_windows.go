@@ -0,0 +1,48 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build windows
+
+package tgo
+
+import (
+	"syscall"
+)
+
+func processCPUSeconds() (float64, bool) {
+	var creation, exit, kernel, user syscall.Filetime
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return 0, false
+	}
+	if err := syscall.GetProcessTimes(process, &creation, &exit, &kernel, &user); err != nil {
+		return 0, false
+	}
+
+	// Filetime values are measured in 100ns intervals
+	ticks := filetimeTicks(kernel) + filetimeTicks(user)
+	return float64(ticks) / 1e7, true
+}
+
+func processOpenFiles() (int, bool) {
+	return 0, false
+}
+
+func processThreads() int {
+	return threadCreateCount()
+}
+
+func filetimeTicks(ft syscall.Filetime) uint64 {
+	return uint64(ft.HighDateTime)<<32 | uint64(ft.LowDateTime)
+}
@@ -0,0 +1,230 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// MetricVec is a family of metrics sharing the same name but being
+// distinguished by a set of label values. Each distinct set of label values
+// is backed by its own atomic counter.
+type MetricVec struct {
+	name         string
+	labels       []string
+	maxLabelSets int
+	values       map[string]*labeledMetric
+	guard        *sync.RWMutex
+}
+
+type labeledMetric struct {
+	labelValues []string
+	value       *int64
+}
+
+type labeledSample struct {
+	labelValues []string
+	value       int64
+}
+
+// NewVec creates a new labeled metric family with the given label names.
+// maxLabelSets limits the number of distinct label value combinations that
+// may be stored in this family. A value of 0 disables the limit.
+// If a family of the same name already exists it is returned if the label
+// names match. Otherwise, or if the name is already used by another metric,
+// an error is returned.
+func (met *Metrics) NewVec(name string, maxLabelSets int, labels ...string) (*MetricVec, error) {
+	if len(labels) == 0 {
+		return nil, fmt.Errorf("Metric family %s requires at least one label", name)
+	}
+
+	met.storeGuard.Lock()
+	defer met.storeGuard.Unlock()
+
+	if vec, exists := met.vecs[name]; exists {
+		if !stringSliceEqual(vec.labels, labels) {
+			return nil, fmt.Errorf("Metric family %s is already registered with labels %v", name, vec.labels)
+		}
+		return vec, nil
+	}
+	if err := met.checkUnused(name); err != nil {
+		return nil, err
+	}
+
+	vec := &MetricVec{
+		name:         name,
+		labels:       append([]string(nil), labels...),
+		maxLabelSets: maxLabelSets,
+		values:       make(map[string]*labeledMetric),
+		guard:        new(sync.RWMutex),
+	}
+	met.vecs[name] = vec
+	return vec, nil
+}
+
+// GetVec returns the labeled metric family registered under the given name.
+// If no such family exists, nil is returned.
+func (met *Metrics) GetVec(name string) *MetricVec {
+	met.storeGuard.RLock()
+	defer met.storeGuard.RUnlock()
+	return met.vecs[name]
+}
+
+// Name returns the name of this metric family.
+func (vec *MetricVec) Name() string {
+	return vec.name
+}
+
+// Labels returns the label names of this metric family.
+func (vec *MetricVec) Labels() []string {
+	return append([]string(nil), vec.labels...)
+}
+
+// WithLabels returns a handle to the metric identified by the given label
+// values. The number of values must match the number of label names.
+// If the label set does not exist yet it is created with a value of 0.
+// An error is returned if creating the label set would exceed the
+// cardinality limit of this family.
+func (vec *MetricVec) WithLabels(labelValues ...string) (*MetricHandle, error) {
+	if len(labelValues) != len(vec.labels) {
+		return nil, fmt.Errorf("Metric family %s expects %d label values, got %d", vec.name, len(vec.labels), len(labelValues))
+	}
+
+	key := labelSetKey(labelValues)
+
+	vec.guard.RLock()
+	metric, exists := vec.values[key]
+	vec.guard.RUnlock()
+
+	if exists {
+		return &MetricHandle{metric.value}, nil // ### return, exists ###
+	}
+
+	vec.guard.Lock()
+	defer vec.guard.Unlock()
+
+	if metric, exists = vec.values[key]; exists {
+		return &MetricHandle{metric.value}, nil // ### return, created concurrently ###
+	}
+
+	if vec.maxLabelSets > 0 && len(vec.values) >= vec.maxLabelSets {
+		return nil, fmt.Errorf("Metric family %s exceeds the limit of %d label sets", vec.name, vec.maxLabelSets)
+	}
+
+	metric = &labeledMetric{
+		labelValues: append([]string(nil), labelValues...),
+		value:       new(int64),
+	}
+	vec.values[key] = metric
+	return &MetricHandle{metric.value}, nil
+}
+
+// Len returns the number of label sets stored in this family.
+func (vec *MetricVec) Len() int {
+	vec.guard.RLock()
+	defer vec.guard.RUnlock()
+	return len(vec.values)
+}
+
+// reset sets all values of this family to 0.
+func (vec *MetricVec) reset() {
+	vec.guard.RLock()
+	for _, metric := range vec.values {
+		atomic.StoreInt64(metric.value, 0)
+	}
+	vec.guard.RUnlock()
+}
+
+// snapshot returns the current values of all label sets, sorted by label
+// values.
+func (vec *MetricVec) snapshot() []labeledSample {
+	vec.guard.RLock()
+	samples := make([]labeledSample, 0, len(vec.values))
+	for _, metric := range vec.values {
+		samples = append(samples, labeledSample{
+			labelValues: metric.labelValues,
+			value:       atomic.LoadInt64(metric.value),
+		})
+	}
+	vec.guard.RUnlock()
+
+	sort.Sort(labeledSampleSlice(samples))
+	return samples
+}
+
+// formatKey returns the name of a label set in the form
+// name{label1="value1",label2="value2"}.
+func (vec *MetricVec) formatKey(labelValues []string) string {
+	key := bytes.NewBufferString(vec.name)
+	key.WriteByte('{')
+	for i, label := range vec.labels {
+		if i > 0 {
+			key.WriteByte(',')
+		}
+		key.WriteString(label)
+		key.WriteByte('=')
+		key.WriteString(strconv.Quote(labelValues[i]))
+	}
+	key.WriteByte('}')
+	return key.String()
+}
+
+// labelSetKey returns a unique key for the given label values. Each value is
+// prefixed by its length, so that no separator can appear inside a value.
+func labelSetKey(labelValues []string) string {
+	key := new(bytes.Buffer)
+	for _, value := range labelValues {
+		key.WriteString(strconv.Itoa(len(value)))
+		key.WriteByte(':')
+		key.WriteString(value)
+	}
+	return key.String()
+}
+
+type labeledSampleSlice []labeledSample
+
+func (s labeledSampleSlice) Len() int {
+	return len(s)
+}
+
+func (s labeledSampleSlice) Less(i, j int) bool {
+	for n, value := range s[i].labelValues {
+		if value != s[j].labelValues[n] {
+			return value < s[j].labelValues[n]
+		}
+	}
+	return false
+}
+
+func (s labeledSampleSlice) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func stringSliceEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,136 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestMetricVec(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	_, err := mockMetric.NewVec("Messages", 0)
+	expect.NotNil(err)
+
+	vec, err := mockMetric.NewVec("Messages", 0, "router", "topic")
+	expect.NoError(err)
+
+	sameVec, err := mockMetric.NewVec("Messages", 0, "router", "topic")
+	expect.NoError(err)
+	expect.Equal(vec, sameVec)
+
+	_, err = mockMetric.NewVec("Messages", 0, "router")
+	expect.NotNil(err)
+
+	_, err = vec.WithLabels("kafka")
+	expect.NotNil(err)
+
+	kafka, err := vec.WithLabels("kafka", "foo")
+	expect.NoError(err)
+	kafka.Inc()
+	kafka.Add(4)
+
+	kafkaAgain, err := vec.WithLabels("kafka", "foo")
+	expect.NoError(err)
+	expect.Equal(int64(5), kafkaAgain.Get())
+
+	file, err := vec.WithLabels("file", "foo")
+	expect.NoError(err)
+	file.Set(3)
+	file.Dec()
+
+	expect.Equal(2, vec.Len())
+	expect.Equal(vec, mockMetric.GetVec("Messages"))
+
+	data, err := mockMetric.Dump()
+	expect.NoError(err)
+
+	values := make(map[string]int64)
+	expect.NoError(json.Unmarshal(data, &values))
+	expect.MapEqual(values, `Messages{router="kafka",topic="foo"}`, int64(5))
+	expect.MapEqual(values, `Messages{router="file",topic="foo"}`, int64(2))
+
+	mockMetric.ResetMetrics()
+	expect.Equal(int64(0), kafka.Get())
+}
+
+func TestMetricVecCardinality(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	vec, err := mockMetric.NewVec("Limited", 2, "id")
+	expect.NoError(err)
+
+	_, err = vec.WithLabels("1")
+	expect.NoError(err)
+	_, err = vec.WithLabels("2")
+	expect.NoError(err)
+	_, err = vec.WithLabels("3")
+	expect.NotNil(err)
+
+	// Existing label sets are still accessible
+	_, err = vec.WithLabels("1")
+	expect.NoError(err)
+	expect.Equal(2, vec.Len())
+}
+
+func TestMetricVecLabelSeparator(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	vec, err := mockMetric.NewVec("Separated", 0, "first", "second")
+	expect.NoError(err)
+
+	first, err := vec.WithLabels("a\x00b", "c")
+	expect.NoError(err)
+	second, err := vec.WithLabels("a", "b\x00c")
+	expect.NoError(err)
+
+	first.Set(1)
+	second.Set(2)
+	expect.Equal(2, vec.Len())
+	expect.Equal(int64(1), first.Get())
+}
+
+func TestMetricVecPrometheus(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockMetric := getMockMetric()
+
+	vec, err := mockMetric.NewVec("Router.Messages", 0, "router.name")
+	expect.NoError(err)
+
+	handle, err := vec.WithLabels("b\"ar")
+	expect.NoError(err)
+	handle.Set(2)
+
+	handle, err = vec.WithLabels("a")
+	expect.NoError(err)
+	handle.Set(1)
+
+	buffer := new(bytes.Buffer)
+	expect.NoError(mockMetric.WritePrometheus(buffer))
+
+	expected := "# HELP Router_Messages Router.Messages\n" +
+		"# TYPE Router_Messages untyped\n" +
+		"Router_Messages{router_name=\"a\"} 1\n" +
+		"Router_Messages{router_name=\"b\\\"ar\"} 2\n"
+
+	expect.Equal(expected, buffer.String())
+}
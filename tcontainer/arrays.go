@@ -111,3 +111,35 @@ func (s Float32Slice) Set(v float32) {
 		s[i] = v
 	}
 }
+
+// Float64Slice is a typedef to allow sortable float64 slices
+type Float64Slice []float64
+
+func (s Float64Slice) Len() int {
+	return len(s)
+}
+
+func (s Float64Slice) Less(i, j int) bool {
+	return s[i] < s[j]
+}
+
+func (s Float64Slice) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Sort is a shortcut for sort.Sort(s)
+func (s Float64Slice) Sort() {
+	sort.Sort(s)
+}
+
+// IsSorted is a shortcut for sort.IsSorted(s)
+func (s Float64Slice) IsSorted() bool {
+	return sort.IsSorted(s)
+}
+
+// Set sets all values in this slice to the given value
+func (s Float64Slice) Set(v float64) {
+	for i := range s {
+		s[i] = v
+	}
+}
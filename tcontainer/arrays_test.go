@@ -103,3 +103,31 @@ func TestFloat32SliceSet(t *testing.T) {
 		expect.Equal(float32(1), v)
 	}
 }
+
+func TestFloat64SliceSort(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	array := make(Float64Slice, 10)
+
+	for i := range array {
+		array[i] = rand.Float64()
+	}
+
+	// force not sorted
+	array[0] = 1
+	array[9] = 0
+
+	expect.False(array.IsSorted())
+	array.Sort()
+	expect.True(array.IsSorted())
+}
+
+func TestFloat64SliceSet(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	array := make(Float64Slice, 10)
+
+	array.Set(float64(1))
+
+	for _, v := range array {
+		expect.Equal(float64(1), v)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package thealthcheck
+
+import (
+	"fmt"
+	"time"
+)
+
+// Cached runs an endpoint's callback in the background every interval
+// instead of calling it for each request. Requests are answered with the
+// result of the last background run. If this result is older than maxAge,
+// the endpoint is reported as unavailable. A maxAge of 0 disables this
+// limit. Until the first background run has finished, the endpoint is
+// reported as unavailable, too.
+// The interval must be positive and maxAge must not be negative, otherwise
+// registering the endpoint panics.
+// Background runs are limited by the check timeout (see SetTimeouts) and
+// are stopped by Close(). After that, requests call the callback directly
+// as if the endpoint was not cached, so that no outdated result is served.
+func Cached(interval time.Duration, maxAge time.Duration) EndpointOption {
+	return func(ep *endpoint) {
+		ep.isCached = true
+		ep.interval = interval
+		ep.maxAge = maxAge
+	}
+}
+
+// checkCache returns an error if the endpoint has been configured with
+// invalid Cached parameters.
+func (ep *endpoint) checkCache(urlPath string) error {
+	switch {
+	case !ep.isCached:
+		return nil
+	case ep.interval <= 0:
+		return fmt.Errorf("ERROR: Health check endpoint %s requires a positive cache interval", urlPath)
+	case ep.maxAge < 0:
+		return fmt.Errorf("ERROR: Health check endpoint %s requires a cache maxAge of 0 or more", urlPath)
+	default:
+		return nil
+	}
+}
+
+// cachedResult returns the result of the last background run
+func (ep *endpoint) cachedResult(urlPath string) checkResult {
+	ep.guard.Lock()
+	defer ep.guard.Unlock()
+
+	if ep.cached == nil {
+		return checkResult{
+			path:     urlPath,
+			code:     StatusServiceUnavailable,
+			body:     "Health check has no result yet",
+			failures: ep.failures,
+		}
+	}
+
+	result := *ep.cached
+	if age := time.Since(ep.cachedAt); ep.maxAge > 0 && age > ep.maxAge {
+		result.code = StatusServiceUnavailable
+		result.body = fmt.Sprintf("Health check result is outdated by %s", age-ep.maxAge)
+	}
+	return result
+}
+
+// refresh runs the callback and stores the result in the cache
+func (ep *endpoint) refresh(urlPath string, timeout time.Duration) {
+	result := ep.run(urlPath, timeout)
+
+	ep.guard.Lock()
+	ep.cached = &result
+	ep.cachedAt = time.Now()
+	ep.guard.Unlock()
+}
+
+// refreshing returns true if the cached result is refreshed in the
+// background, i.e. stopBackground has not been called.
+func (ep *endpoint) refreshing() bool {
+	ep.guard.Lock()
+	defer ep.guard.Unlock()
+	return !ep.stopped
+}
+
+// startBackground refreshes the cached result every interval until
+// stopBackground is called. The first refresh happens immediately. If
+// stopBackground has already been called, nothing happens.
+func (ep *endpoint) startBackground(urlPath string, checkTimeout func() time.Duration) {
+	stop := make(chan struct{})
+	ep.guard.Lock()
+	if ep.stopped {
+		ep.guard.Unlock()
+		return // ### return, already stopped ###
+	}
+	ep.stop = stop
+	ep.guard.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(ep.interval)
+		defer ticker.Stop()
+
+		for {
+			ep.refresh(urlPath, checkTimeout())
+
+			select {
+			case <-stop:
+				return // ### return, stopped ###
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// stopBackground stops refreshing the cached result and prevents
+// startBackground from starting it again. Calling this function on an
+// endpoint without background checks does nothing else.
+func (ep *endpoint) stopBackground() {
+	ep.guard.Lock()
+	defer ep.guard.Unlock()
+
+	ep.stopped = true
+	if ep.stop != nil {
+		close(ep.stop)
+		ep.stop = nil
+	}
+}
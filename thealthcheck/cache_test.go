@@ -0,0 +1,158 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package thealthcheck
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestHealthCheckCached(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	hc := New("")
+	defer hc.Close()
+
+	calls := int32(0)
+	block := make(chan struct{})
+	hc.AddEndpoint("/expensive", func() (int, string) {
+		<-block
+		atomic.AddInt32(&calls, 1)
+		return StatusOK, "OK"
+	}, Cached(time.Hour, 50*time.Millisecond))
+
+	// No result before the first background run
+	code, body := probe(hc, "/expensive")
+	expect.Equal(StatusServiceUnavailable, code)
+	expect.Equal("Health check has no result yet\n", body)
+
+	close(block)
+	expect.NonBlocking(time.Second, func() {
+		for code != StatusOK {
+			time.Sleep(time.Millisecond)
+			code, _ = probe(hc, "/expensive")
+		}
+	})
+
+	// Requests do not call the callback
+	for i := 0; i < 10; i++ {
+		code, body = probe(hc, "/_ALL_")
+		expect.Equal(StatusOK, code)
+		expect.Equal("/expensive 200 OK\n", body)
+	}
+	expect.Equal(int32(1), atomic.LoadInt32(&calls))
+
+	// Outdated results fail
+	time.Sleep(60 * time.Millisecond)
+	code, body = probe(hc, "/expensive")
+	expect.Equal(StatusServiceUnavailable, code)
+	expect.Contains(body, "Health check result is outdated by ")
+}
+
+func TestHealthCheckCachedRefresh(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	hc := New("")
+
+	calls := int32(0)
+	hc.AddEndpoint("/refreshed", func() (int, string) {
+		atomic.AddInt32(&calls, 1)
+		return StatusOK, "OK"
+	}, Cached(5*time.Millisecond, 0))
+
+	expect.NonBlocking(time.Second, func() {
+		for atomic.LoadInt32(&calls) < 3 {
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	expect.NoError(hc.Close())
+	stopped := atomic.LoadInt32(&calls)
+	time.Sleep(20 * time.Millisecond)
+	expect.Leq(atomic.LoadInt32(&calls), stopped+1)
+}
+
+func TestHealthCheckCachedAfterClose(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	hc := New("")
+
+	fooCode := int32(StatusOK)
+	hc.AddEndpoint("/foo", func() (int, string) {
+		return int(atomic.LoadInt32(&fooCode)), "foo"
+	}, Cached(time.Hour, 0))
+
+	expect.NonBlocking(time.Second, func() {
+		for code, _ := probe(hc, "/foo"); code != StatusOK; code, _ = probe(hc, "/foo") {
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	// Without background checks the cached result would be served forever
+	expect.NoError(hc.Close())
+	atomic.StoreInt32(&fooCode, StatusServiceUnavailable)
+	code, body := probe(hc, "/foo")
+	expect.Equal(StatusServiceUnavailable, code)
+	expect.Equal("foo\n", body)
+}
+
+func TestHealthCheckCachedStopBeforeStart(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	calls := int32(0)
+	ep := &endpoint{
+		callback: func() (int, string) {
+			atomic.AddInt32(&calls, 1)
+			return StatusOK, "OK"
+		},
+		interval: time.Millisecond,
+		guard:    new(sync.Mutex),
+	}
+
+	// A stopped endpoint cannot be started afterwards
+	ep.stopBackground()
+	ep.startBackground("/foo", func() time.Duration { return 0 })
+	time.Sleep(10 * time.Millisecond)
+
+	expect.Nil(ep.stop)
+	expect.Equal(int32(0), atomic.LoadInt32(&calls))
+}
+
+func TestHealthCheckCachedInvalid(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	hc := New("")
+	defer hc.Close()
+	callback := func() (int, string) { return StatusOK, "" }
+
+	options := []EndpointOption{
+		Cached(0, 0),
+		Cached(-time.Second, time.Minute),
+		Cached(time.Second, -time.Minute),
+	}
+	for _, option := range options {
+		panicked := func() (panicked bool) {
+			defer func() { panicked = recover() != nil }()
+			hc.AddEndpoint("/foo", callback, option)
+			return false
+		}()
+		expect.True(panicked)
+	}
+
+	// Nothing has been registered
+	code, _ := probe(hc, "/foo")
+	expect.Equal(http.StatusNotFound, code)
+}
@@ -0,0 +1,125 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package thealthcheck
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/trivago/tgo"
+)
+
+// TCPCheck returns a callback that passes if a TCP connection to the given
+// address can be established within timeout. A timeout of 0 uses the
+// operating system's default.
+func TCPCheck(address string, timeout time.Duration) CallbackFunc {
+	return dialCheck("tcp", address, timeout)
+}
+
+// UnixSocketCheck returns a callback that passes if a connection to the
+// unix domain socket at the given path can be established within timeout.
+// A timeout of 0 uses the operating system's default.
+func UnixSocketCheck(path string, timeout time.Duration) CallbackFunc {
+	return dialCheck("unix", path, timeout)
+}
+
+func dialCheck(network string, address string, timeout time.Duration) CallbackFunc {
+	return func() (int, string) {
+		conn, err := net.DialTimeout(network, address, timeout)
+		if err != nil {
+			return StatusServiceUnavailable, fmt.Sprintf("Failed to connect to %s: %s", address, err)
+		}
+		conn.Close()
+		return StatusOK, fmt.Sprintf("%s is reachable", address)
+	}
+}
+
+// HTTPCheck returns a callback that sends a GET request to the given URL and
+// passes if the response code equals expectedCode. The request, including
+// reading the response body, is limited by timeout. A timeout of 0 disables
+// this limit. Redirects are followed.
+func HTTPCheck(url string, expectedCode int, timeout time.Duration) CallbackFunc {
+	client := &http.Client{
+		Timeout: timeout,
+	}
+	return func() (int, string) {
+		response, err := client.Get(url)
+		if err != nil {
+			return StatusServiceUnavailable, fmt.Sprintf("GET %s failed: %s", url, err)
+		}
+		io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+
+		if response.StatusCode != expectedCode {
+			return StatusServiceUnavailable, fmt.Sprintf("GET %s returned %d, expected %d", url, response.StatusCode, expectedCode)
+		}
+		return StatusOK, fmt.Sprintf("GET %s returned %d", url, response.StatusCode)
+	}
+}
+
+// DiskSpaceCheck returns a callback that passes if the file system holding
+// the given path has at least minFreeBytes available to unprivileged users.
+// This check is only supported on linux, darwin and freebsd. On other
+// platforms it always fails.
+func DiskSpaceCheck(path string, minFreeBytes uint64) CallbackFunc {
+	return func() (int, string) {
+		freeBytes, err := freeDiskSpace(path)
+		if err != nil {
+			return StatusServiceUnavailable, fmt.Sprintf("Failed to get free disk space of %s: %s", path, err)
+		}
+		if freeBytes < minFreeBytes {
+			return StatusServiceUnavailable, fmt.Sprintf("%s has %d bytes free, expected at least %d", path, freeBytes, minFreeBytes)
+		}
+		return StatusOK, fmt.Sprintf("%s has %d bytes free", path, freeBytes)
+	}
+}
+
+// FileFreshnessCheck returns a callback that passes if the file at the
+// given path has been modified within maxAge. This is useful to check if
+// files written periodically, e.g. by cron jobs, are up to date.
+func FileFreshnessCheck(path string, maxAge time.Duration) CallbackFunc {
+	return func() (int, string) {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return StatusServiceUnavailable, fmt.Sprintf("Failed to stat %s: %s", path, err)
+		}
+		age := time.Since(stat.ModTime())
+		if age > maxAge {
+			return StatusServiceUnavailable, fmt.Sprintf("%s has not been modified for %s, expected at most %s", path, age, maxAge)
+		}
+		return StatusOK, fmt.Sprintf("%s has been modified %s ago", path, age)
+	}
+}
+
+// MetricCheck returns a callback that passes if the given metric or rate is
+// within [min, max]. Use math.Inf to check against one bound only. If the
+// metric does not exist, the check fails.
+func MetricCheck(metrics *tgo.Metrics, name string, min float64, max float64) CallbackFunc {
+	return func() (int, string) {
+		value, err := metrics.GetFloat(name)
+		if err != nil {
+			return StatusServiceUnavailable, err.Error()
+		}
+		if value < min || value > max {
+			return StatusServiceUnavailable, fmt.Sprintf("%s is %v, expected a value in [%v, %v]", name, value, min, max)
+		}
+		return StatusOK, fmt.Sprintf("%s is %v", name, value)
+	}
+}
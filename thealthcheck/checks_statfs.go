@@ -0,0 +1,37 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build linux darwin freebsd
+
+package thealthcheck
+
+import (
+	"syscall"
+)
+
+// freeDiskSpace returns the number of bytes available to unprivileged users
+// on the file system holding the given path.
+func freeDiskSpace(path string) (uint64, error) {
+	stat := syscall.Statfs_t{}
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	// Bavail is signed on some platforms and can become negative if the
+	// reserved blocks are in use.
+	available := int64(stat.Bavail)
+	if available < 0 {
+		return 0, nil // ### return, reserved blocks in use ###
+	}
+	return uint64(available) * uint64(stat.Bsize), nil
+}
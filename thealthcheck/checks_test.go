@@ -0,0 +1,151 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package thealthcheck
+
+import (
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/trivago/tgo"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestTCPCheck(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	expect.NoError(err)
+	address := listener.Addr().String()
+
+	code, _ := TCPCheck(address, time.Second)()
+	expect.Equal(StatusOK, code)
+
+	listener.Close()
+	code, _ = TCPCheck(address, time.Second)()
+	expect.Equal(StatusServiceUnavailable, code)
+}
+
+func TestUnixSocketCheck(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix sockets are not supported on windows")
+	}
+
+	dir, err := ioutil.TempDir("", "thealthcheck")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "check.sock")
+
+	code, _ := UnixSocketCheck(path, time.Second)()
+	expect.Equal(StatusServiceUnavailable, code)
+
+	listener, err := net.Listen("unix", path)
+	expect.NoError(err)
+	defer listener.Close()
+
+	code, _ = UnixSocketCheck(path, time.Second)()
+	expect.Equal(StatusOK, code)
+}
+
+func TestHTTPCheck(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, httpRequest *http.Request) {
+		if httpRequest.URL.Path == "/slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		responseWriter.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	code, body := HTTPCheck(server.URL, http.StatusNoContent, time.Second)()
+	expect.Equal(StatusOK, code)
+	expect.Equal("GET "+server.URL+" returned 204", body)
+
+	code, body = HTTPCheck(server.URL, http.StatusOK, time.Second)()
+	expect.Equal(StatusServiceUnavailable, code)
+	expect.Equal("GET "+server.URL+" returned 204, expected 200", body)
+
+	code, _ = HTTPCheck(server.URL+"/slow", http.StatusNoContent, 10*time.Millisecond)()
+	expect.Equal(StatusServiceUnavailable, code)
+}
+
+func TestDiskSpaceCheck(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	if _, err := freeDiskSpace(os.TempDir()); err != nil {
+		t.Skip(err)
+	}
+
+	code, _ := DiskSpaceCheck(os.TempDir(), 0)()
+	expect.Equal(StatusOK, code)
+
+	code, _ = DiskSpaceCheck(os.TempDir(), math.MaxUint64)()
+	expect.Equal(StatusServiceUnavailable, code)
+
+	code, _ = DiskSpaceCheck(filepath.Join(os.TempDir(), "thealthcheck-missing"), 0)()
+	expect.Equal(StatusServiceUnavailable, code)
+}
+
+func TestFileFreshnessCheck(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "thealthcheck")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "heartbeat")
+
+	code, _ := FileFreshnessCheck(path, time.Minute)()
+	expect.Equal(StatusServiceUnavailable, code)
+
+	expect.NoError(ioutil.WriteFile(path, []byte{}, 0644))
+	code, _ = FileFreshnessCheck(path, time.Minute)()
+	expect.Equal(StatusOK, code)
+
+	old := time.Now().Add(-time.Hour)
+	expect.NoError(os.Chtimes(path, old, old))
+	code, _ = FileFreshnessCheck(path, time.Minute)()
+	expect.Equal(StatusServiceUnavailable, code)
+}
+
+func TestMetricCheck(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	metrics := tgo.NewMetrics()
+	check := MetricCheck(metrics, "queue", 0, 10)
+
+	code, _ := check()
+	expect.Equal(StatusServiceUnavailable, code)
+
+	metrics.New("queue")
+	metrics.Set("queue", 10)
+	code, body := check()
+	expect.Equal(StatusOK, code)
+	expect.Equal("queue is 10", body)
+
+	metrics.Set("queue", 11)
+	code, body = check()
+	expect.Equal(StatusServiceUnavailable, code)
+	expect.Equal("queue is 11, expected a value in [0, 10]", body)
+
+	code, _ = MetricCheck(metrics, "queue", 5, math.Inf(1))()
+	expect.Equal(StatusOK, code)
+}
@@ -0,0 +1,119 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package thealthcheck
+
+import (
+	"fmt"
+)
+
+// DependsOn declares that an endpoint requires the endpoints registered on
+// the given paths. When probing an aggregate endpoint, the endpoint is only
+// called after its dependencies passed. If a dependency failed, the
+// endpoint is skipped and reported as unavailable. Dependencies that are
+// not part of the probed endpoints are ignored, as are dependencies of
+// endpoints requested directly.
+// Dependencies do not need to be registered before the endpoint is added,
+// but circular dependencies are rejected.
+func DependsOn(urlPaths ...string) EndpointOption {
+	return func(ep *endpoint) {
+		ep.dependencies = append(ep.dependencies, urlPaths...)
+	}
+}
+
+// Optional marks an endpoint as not critical. A failing optional endpoint
+// does not fail an aggregate endpoint but degrades it, i.e. the aggregate
+// reports StatusTextDegraded with the response code StatusDegraded (see
+// SetDegradedCode).
+// Optional endpoints are not counted by group rules.
+func Optional() EndpointOption {
+	return func(ep *endpoint) {
+		ep.optional = true
+	}
+}
+
+// checkDependencies returns an error if registering ep on urlPath would
+// create a circular dependency. The routeGuard has to be locked when calling
+// this function.
+func (hc *HealthCheckServer) checkDependencies(urlPath string, ep *endpoint) error {
+	visited := make(map[string]bool)
+	pending := append([]string{}, ep.dependencies...)
+
+	for len(pending) > 0 {
+		dependency := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if dependency == urlPath {
+			return fmt.Errorf(
+				"ERROR: Health check endpoint \"%s\" has a circular dependency", urlPath)
+		}
+		if visited[dependency] {
+			continue // ### continue, already checked ###
+		}
+		visited[dependency] = true
+
+		if next, exists := hc.endpoints[dependency]; exists {
+			pending = append(pending, next.dependencies...)
+		}
+	}
+	return nil
+}
+
+// skip returns the result of an endpoint that has not been called because
+// the given dependency failed. The skipped endpoint only counts as critical
+// failure if the failed dependency is critical, too, i.e. a failing optional
+// dependency degrades but does not fail an aggregate. The statistics of the
+// endpoint are not changed.
+func (ep *endpoint) skip(urlPath string, dependency string, dependencyOptional bool) checkResult {
+	ep.guard.Lock()
+	defer ep.guard.Unlock()
+
+	return checkResult{
+		path:        urlPath,
+		code:        StatusServiceUnavailable,
+		body:        fmt.Sprintf("Health check skipped, dependency %s failed", dependency),
+		lastSuccess: ep.lastSuccess,
+		failures:    ep.failures,
+		optional:    ep.optional || dependencyOptional,
+		skipped:     true,
+	}
+}
+
+// aggregateStatus evaluates the results of an aggregate endpoint. Critical
+// endpoints are passed to rule. If the rule passes but an optional endpoint
+// failed, the aggregate is degraded and degradedCode is returned.
+func aggregateStatus(results []checkResult, rule GroupRule, degradedCode int) (code int, status string) {
+	var passed, failed int
+	degraded := false
+
+	for _, result := range results {
+		switch {
+		case result.optional:
+			degraded = degraded || result.code != StatusOK
+		case result.code == StatusOK:
+			passed++
+		default:
+			failed++
+		}
+	}
+
+	switch {
+	case !rule(passed, failed):
+		return StatusServiceUnavailable, StatusTextFailed
+	case degraded:
+		return degradedCode, StatusTextDegraded
+	default:
+		return StatusOK, StatusTextOK
+	}
+}
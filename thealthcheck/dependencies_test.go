@@ -0,0 +1,180 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package thealthcheck
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestHealthCheckDependencies(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	hc := New("")
+
+	databaseCode, cacheCode := StatusOK, StatusOK
+	apiCalls := int32(0)
+
+	hc.AddEndpoint("/api", func() (int, string) {
+		atomic.AddInt32(&apiCalls, 1)
+		return StatusOK, "api"
+	}, DependsOn("/database"))
+	hc.AddEndpoint("/web", func() (int, string) {
+		return StatusOK, "web"
+	}, DependsOn("/api"))
+	hc.AddEndpoint("/database", func() (int, string) {
+		return databaseCode, "database"
+	})
+	hc.AddEndpoint("/cache", func() (int, string) {
+		return cacheCode, "cache"
+	}, Optional())
+
+	recorder := httptest.NewRecorder()
+	hc.ServeHTTP(recorder, httptest.NewRequest("GET", "/_ALL_", nil))
+	expect.Equal(StatusOK, recorder.Code)
+	expect.Equal(StatusTextOK, recorder.Header().Get(StatusHeader))
+	expect.Equal(int32(1), atomic.LoadInt32(&apiCalls))
+
+	// Optional endpoints degrade the aggregate
+	cacheCode = StatusServiceUnavailable
+	recorder = httptest.NewRecorder()
+	hc.ServeHTTP(recorder, httptest.NewRequest("GET", "/_ALL_", nil))
+	expect.Equal(StatusDegraded, recorder.Code)
+	expect.Equal(StatusTextDegraded, recorder.Header().Get(StatusHeader))
+	expect.Contains(recorder.Body.String(), "/cache 503 cache\n")
+
+	// Dependents of failed endpoints are skipped
+	databaseCode = StatusServiceUnavailable
+	recorder = httptest.NewRecorder()
+	hc.ServeHTTP(recorder, httptest.NewRequest("GET", "/_ALL_", nil))
+	expect.Equal(StatusServiceUnavailable, recorder.Code)
+	expect.Equal(StatusTextFailed, recorder.Header().Get(StatusHeader))
+	expect.Equal("/api 503 Health check skipped, dependency /database failed\n"+
+		"/cache 503 cache\n"+
+		"/database 503 database\n"+
+		"/web 503 Health check skipped, dependency /api failed\n", recorder.Body.String())
+	expect.Equal(int32(2), atomic.LoadInt32(&apiCalls))
+
+	recorder = httptest.NewRecorder()
+	httpRequest := httptest.NewRequest("GET", "/_ALL_?format=json", nil)
+	hc.ServeHTTP(recorder, httpRequest)
+
+	aggregate := jsonAggregate{}
+	expect.NoError(json.Unmarshal(recorder.Body.Bytes(), &aggregate))
+	expect.Equal(StatusTextFailed, aggregate.Status)
+	if expect.Equal(4, len(aggregate.Checks)) {
+		api, cache := aggregate.Checks[0], aggregate.Checks[1]
+		expect.Equal(StatusTextSkipped, api.Status)
+		expect.True(api.Critical)
+		expect.Equal(StatusTextFailed, cache.Status)
+		expect.False(cache.Critical)
+	}
+
+	// Endpoints requested directly are always called
+	code, body := probe(hc, "/api")
+	expect.Equal(StatusOK, code)
+	expect.Equal("api\n", body)
+	expect.Equal(int32(3), atomic.LoadInt32(&apiCalls))
+
+	// Dependencies outside of a group are ignored
+	hc.SetEndpoint("/api", func() (int, string) {
+		return StatusOK, "api"
+	}, DependsOn("/database"), InGroups(GroupReadiness))
+	code, _ = probe(hc, "/_READINESS_")
+	expect.Equal(StatusOK, code)
+}
+
+func TestHealthCheckDegradedCode(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	hc := New("")
+
+	hc.AddEndpoint("/database", func() (int, string) {
+		return StatusOK, "database"
+	})
+	hc.AddEndpoint("/cache", func() (int, string) {
+		return StatusServiceUnavailable, "cache"
+	}, Optional())
+
+	// The header tells degraded and healthy services apart
+	recorder := httptest.NewRecorder()
+	hc.ServeHTTP(recorder, httptest.NewRequest("GET", "/_ALL_", nil))
+	expect.Equal(StatusOK, recorder.Code)
+	expect.Equal(StatusTextDegraded, recorder.Header().Get(StatusHeader))
+
+	hc.SetDegradedCode(StatusServiceUnavailable)
+	code, _ := probe(hc, "/_ALL_")
+	expect.Equal(StatusServiceUnavailable, code)
+}
+
+func TestHealthCheckOptionalDependency(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	hc := New("")
+
+	hc.AddEndpoint("/cache", func() (int, string) {
+		return StatusServiceUnavailable, "cache"
+	}, Optional())
+	hc.AddEndpoint("/warmup", func() (int, string) {
+		return StatusOK, "warmup"
+	}, DependsOn("/cache"))
+	hc.AddEndpoint("/stats", func() (int, string) {
+		return StatusOK, "stats"
+	}, DependsOn("/warmup"))
+
+	// Endpoints skipped due to an optional dependency degrade the aggregate
+	recorder := httptest.NewRecorder()
+	hc.ServeHTTP(recorder, httptest.NewRequest("GET", "/_ALL_", nil))
+	expect.Equal(StatusDegraded, recorder.Code)
+	expect.Equal(StatusTextDegraded, recorder.Header().Get(StatusHeader))
+	expect.Contains(recorder.Body.String(), "/stats 503 Health check skipped, dependency /warmup failed\n")
+
+	// Critical dependencies still fail the aggregate
+	hc.AddEndpoint("/database", func() (int, string) {
+		return StatusServiceUnavailable, "database"
+	})
+	hc.SetEndpoint("/warmup", func() (int, string) {
+		return StatusOK, "warmup"
+	}, DependsOn("/cache", "/database"))
+
+	recorder = httptest.NewRecorder()
+	hc.ServeHTTP(recorder, httptest.NewRequest("GET", "/_ALL_", nil))
+	expect.Equal(StatusServiceUnavailable, recorder.Code)
+	expect.Equal(StatusTextFailed, recorder.Header().Get(StatusHeader))
+	expect.Contains(recorder.Body.String(), "/warmup 503 Health check skipped, dependency /database failed\n")
+}
+
+func TestHealthCheckCircularDependencies(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	hc := New("")
+	callback := func() (int, string) { return StatusOK, "" }
+
+	hc.AddEndpoint("/a", callback, DependsOn("/b"))
+	hc.AddEndpoint("/b", callback, DependsOn("/c"))
+
+	for _, dependency := range []string{"/a", "/b", "/c"} {
+		panicked := func() (panicked bool) {
+			defer func() { panicked = recover() != nil }()
+			hc.AddEndpoint("/c", callback, DependsOn(dependency))
+			return false
+		}()
+		expect.True(panicked)
+	}
+
+	hc.AddEndpoint("/c", callback, DependsOn("/d"))
+	code, _ := probe(hc, "/_ALL_")
+	expect.Equal(StatusOK, code)
+}
@@ -0,0 +1,150 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package thealthcheck
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// EndpointOption configures an endpoint when passed to AddEndpoint
+type EndpointOption func(*endpoint)
+
+// endpoint holds the state of a registered health check endpoint
+type endpoint struct {
+	callback     CallbackFunc
+	groups       []string
+	dependencies []string
+	optional     bool
+	lastSuccess  time.Time
+	failures     int
+	isCached     bool
+	interval     time.Duration
+	maxAge       time.Duration
+	cached       *checkResult
+	cachedAt     time.Time
+	stop         chan struct{}
+	stopped      bool
+	history      []historyEntry
+	historySize  int
+	damping      int
+	stableCode   int
+	pending      int
+	inFlight     *callbackRun
+	guard        *sync.Mutex
+}
+
+// callbackRun holds the result of a callback running in its own go routine.
+// The result is valid once done has been closed.
+type callbackRun struct {
+	done chan struct{}
+	code int
+	body string
+}
+
+// result returns the cached result of background checks or calls the
+// endpoint's callback with the given timeout.
+func (ep *endpoint) result(urlPath string, timeout time.Duration) checkResult {
+	var result checkResult
+	if ep.interval > 0 && ep.refreshing() {
+		result = ep.cachedResult(urlPath)
+	} else {
+		result = ep.run(urlPath, timeout)
+	}
+	result.optional = ep.optional
+	return result
+}
+
+// run calls the endpoint's callback with the given timeout and updates the
+// endpoint's statistics and history.
+func (ep *endpoint) run(urlPath string, timeout time.Duration) checkResult {
+	start := time.Now()
+	code, body := ep.call(timeout)
+
+	result := checkResult{
+		path:     urlPath,
+		code:     code,
+		body:     body,
+		duration: time.Since(start),
+	}
+
+	ep.guard.Lock()
+	defer ep.guard.Unlock()
+
+	if code == StatusOK {
+		ep.lastSuccess = start
+		ep.failures = 0
+	} else {
+		ep.failures++
+	}
+	result.lastSuccess = ep.lastSuccess
+	result.failures = ep.failures
+	ep.record(&result, start)
+	return result
+}
+
+// call runs the endpoint's callback and returns its result. If the callback
+// does not return within timeout, StatusServiceUnavailable is returned. A
+// timeout of 0 disables the limit.
+// Only one callback per endpoint is running at a time, i.e. if a previous
+// call is still running, its result is awaited instead of calling the
+// callback again. This prevents hanging checks from piling up go routines.
+func (ep *endpoint) call(timeout time.Duration) (code int, body string) {
+	ep.guard.Lock()
+	run := ep.inFlight
+	if run == nil {
+		run = &callbackRun{done: make(chan struct{})}
+		ep.inFlight = run
+		go ep.execute(run)
+	}
+	ep.guard.Unlock()
+
+	if timeout == 0 {
+		<-run.done
+		return run.code, run.body
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-run.done:
+		return run.code, run.body
+	case <-timer.C:
+		return StatusServiceUnavailable, fmt.Sprintf("Health check timed out after %s", timeout)
+	}
+}
+
+// execute calls the endpoint's callback, stores its result in the given run
+// and allows the next call to start a new run.
+func (ep *endpoint) execute(run *callbackRun) {
+	run.code, run.body = ep.callback()
+
+	ep.guard.Lock()
+	ep.inFlight = nil
+	ep.guard.Unlock()
+	close(run.done)
+}
+
+// inGroup returns true if the endpoint is a member of the given group
+func (ep *endpoint) inGroup(name string) bool {
+	for _, grp := range ep.groups {
+		if grp == name {
+			return true
+		}
+	}
+	return false
+}
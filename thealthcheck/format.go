@@ -0,0 +1,170 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package thealthcheck
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/trivago/tgo/tnet/thttp"
+)
+
+const (
+	// StatusTextOK is the JSON status of passing checks
+	StatusTextOK = "OK"
+	// StatusTextFailed is the JSON status of failing checks
+	StatusTextFailed = "FAILED"
+	// StatusTextDegraded is the status of aggregates with failing optional
+	// checks
+	StatusTextDegraded = "DEGRADED"
+	// StatusTextSkipped is the JSON status of checks skipped because of a
+	// failed dependency
+	StatusTextSkipped = "SKIPPED"
+)
+
+// StatusHeader is the HTTP header holding the status of aggregate endpoints
+const StatusHeader = "X-Health-Status"
+
+// jsonResult is the JSON representation of a single check
+type jsonResult struct {
+	Path                string     `json:"path"`
+	Status              string     `json:"status"`
+	Code                int        `json:"code"`
+	Critical            bool       `json:"critical"`
+	Message             string     `json:"message"`
+	DurationMs          float64    `json:"durationMs"`
+	LastSuccess         *time.Time `json:"lastSuccess"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+}
+
+// jsonAggregate is the JSON representation of an aggregate endpoint
+type jsonAggregate struct {
+	Status string       `json:"status"`
+	Code   int          `json:"code"`
+	Checks []jsonResult `json:"checks"`
+}
+
+// writeResult writes the result of a single endpoint as text or JSON
+func writeResult(responseWriter http.ResponseWriter, httpRequest *http.Request, result checkResult) {
+	if wantsJSON(httpRequest) {
+		writeJSON(responseWriter, result.code, newJSONResult(result))
+		return
+	}
+
+	// Set HTTP response code
+	responseWriter.WriteHeader(result.code)
+	// Write HTTP response body
+	io.WriteString(responseWriter, result.body)
+	io.WriteString(responseWriter, "\n")
+}
+
+// writeResults writes the results of an aggregate endpoint as text or JSON.
+// The status is written to the StatusHeader, too.
+func writeResults(responseWriter http.ResponseWriter, httpRequest *http.Request, code int, status string, results []checkResult) {
+	responseWriter.Header().Set(StatusHeader, status)
+
+	if wantsJSON(httpRequest) {
+		aggregate := jsonAggregate{
+			Status: status,
+			Code:   code,
+			Checks: make([]jsonResult, 0, len(results)),
+		}
+		for _, result := range results {
+			aggregate.Checks = append(aggregate.Checks, newJSONResult(result))
+		}
+		writeJSON(responseWriter, code, aggregate)
+		return
+	}
+
+	// Response code needs to be set before writing the response body,
+	// so we need to pool the body temporarily into resultBody
+	var resultBody bytes.Buffer
+	for _, result := range results {
+		// Append path, code, body to response body
+		fmt.Fprintf(&resultBody,
+			"%s %d %s\n",
+			result.path,
+			result.code,
+			result.body,
+		)
+	}
+
+	// Set HTTP response code
+	responseWriter.WriteHeader(code)
+
+	// Write HTTP response body
+	resultBody.WriteTo(responseWriter)
+}
+
+func writeJSON(responseWriter http.ResponseWriter, code int, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.WriteHeader(code)
+	responseWriter.Write(data)
+	io.WriteString(responseWriter, "\n")
+}
+
+func newJSONResult(result checkResult) jsonResult {
+	converted := jsonResult{
+		Path:                result.path,
+		Status:              statusText(result.code),
+		Code:                result.code,
+		Critical:            !result.optional,
+		Message:             result.body,
+		DurationMs:          float64(result.duration) / float64(time.Millisecond),
+		ConsecutiveFailures: result.failures,
+	}
+	if result.skipped {
+		converted.Status = StatusTextSkipped
+	}
+	if !result.lastSuccess.IsZero() {
+		lastSuccess := result.lastSuccess
+		converted.LastSuccess = &lastSuccess
+	}
+	return converted
+}
+
+// statusText returns the JSON status of a response code
+func statusText(code int) string {
+	if code == StatusOK {
+		return StatusTextOK
+	}
+	return StatusTextFailed
+}
+
+// wantsJSON returns true if JSON has been requested by the query parameter
+// "format" or, if this parameter is not set, by the Accept header. JSON is
+// only chosen via the Accept header if it is preferred over text/plain.
+func wantsJSON(httpRequest *http.Request) bool {
+	switch strings.ToLower(httpRequest.URL.Query().Get("format")) {
+	case "json":
+		return true
+	case "text":
+		return false
+	}
+
+	accept := httpRequest.Header.Get("Accept")
+	return thttp.NegotiateContentType(accept, "text/plain", "application/json") == "application/json"
+}
@@ -0,0 +1,111 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package thealthcheck
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestWantsJSON(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	request := func(target string, accept string) bool {
+		httpRequest := httptest.NewRequest("GET", target, nil)
+		if accept != "" {
+			httpRequest.Header.Set("Accept", accept)
+		}
+		return wantsJSON(httpRequest)
+	}
+
+	expect.False(request("/", ""))
+	expect.False(request("/", "*/*"))
+	expect.False(request("/", "text/plain, application/json;q=0.9"))
+	expect.True(request("/", "application/json"))
+	expect.True(request("/", "application/json, */*;q=0.1"))
+	expect.True(request("/", "text/plain;q=0, */*"))
+	expect.False(request("/", "application/json;q=0, */*"))
+	expect.True(request("/?format=json", "text/plain"))
+	expect.False(request("/?format=text", "application/json"))
+}
+
+func TestHealthCheckJSON(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	hc := New("")
+
+	fooCode := StatusOK
+	hc.AddEndpoint("/foo", func() (int, string) {
+		return fooCode, "foo"
+	})
+	hc.AddEndpoint("/bar", func() (int, string) {
+		return StatusServiceUnavailable, "bar is down"
+	})
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		httpRequest := httptest.NewRequest("GET", target, nil)
+		httpRequest.Header.Set("Accept", "application/json")
+		hc.ServeHTTP(recorder, httpRequest)
+		return recorder
+	}
+
+	before := time.Now()
+	response := serve("/foo")
+	expect.Equal(StatusOK, response.Code)
+	expect.Equal("application/json", response.Header().Get("Content-Type"))
+
+	result := jsonResult{}
+	expect.NoError(json.Unmarshal(response.Body.Bytes(), &result))
+	expect.Equal("/foo", result.Path)
+	expect.Equal(StatusTextOK, result.Status)
+	expect.Equal(StatusOK, result.Code)
+	expect.Equal("foo", result.Message)
+	expect.Equal(0, result.ConsecutiveFailures)
+	expect.Geq(result.DurationMs, 0.0)
+	if expect.NotNil(result.LastSuccess) {
+		expect.False(result.LastSuccess.Before(before.Truncate(time.Second)))
+	}
+
+	fooCode = StatusServiceUnavailable
+	serve("/foo")
+	response = serve("/_ALL_")
+	expect.Equal(StatusServiceUnavailable, response.Code)
+
+	aggregate := jsonAggregate{}
+	expect.NoError(json.Unmarshal(response.Body.Bytes(), &aggregate))
+	expect.Equal(StatusTextFailed, aggregate.Status)
+	expect.Equal(StatusServiceUnavailable, aggregate.Code)
+	if expect.Equal(2, len(aggregate.Checks)) {
+		bar, foo := aggregate.Checks[0], aggregate.Checks[1]
+		expect.Equal("/bar", bar.Path)
+		expect.Equal("bar is down", bar.Message)
+		expect.Equal(1, bar.ConsecutiveFailures)
+		expect.Nil(bar.LastSuccess)
+
+		expect.Equal("/foo", foo.Path)
+		expect.Equal(StatusTextFailed, foo.Status)
+		expect.Equal(2, foo.ConsecutiveFailures)
+		expect.NotNil(foo.LastSuccess)
+	}
+
+	// Text stays the default
+	code, body := probe(hc, "/foo")
+	expect.Equal(StatusServiceUnavailable, code)
+	expect.Equal("foo\n", body)
+}
@@ -0,0 +1,158 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package thealthcheck
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+const (
+	// GroupLiveness is served on "/_LIVENESS_" and passes if all of its
+	// endpoints pass.
+	GroupLiveness = "liveness"
+	// GroupReadiness is served on "/_READINESS_" and passes if all of its
+	// endpoints pass.
+	GroupReadiness = "readiness"
+	// GroupStartup is served on "/_STARTUP_". It passes once all of its
+	// endpoints passed and keeps passing afterwards.
+	GroupStartup = "startup"
+)
+
+// GroupRule decides if a group passes, based on the number of passed and
+// failed endpoints of a probe. An endpoint passes if it returns StatusOK.
+type GroupRule func(passed, failed int) bool
+
+// group holds the configuration of an aggregate endpoint
+type group struct {
+	path string
+	rule GroupRule
+}
+
+// AllPassing is a GroupRule that passes if no endpoint failed
+func AllPassing(passed, failed int) bool {
+	return failed == 0
+}
+
+// AnyPassing is a GroupRule that passes if at least one endpoint passed or
+// if the group has no endpoints.
+func AnyPassing(passed, failed int) bool {
+	return passed > 0 || failed == 0
+}
+
+// Latched returns a GroupRule that passes once the given rule passed and
+// keeps passing afterwards. This is useful for startup checks.
+// The rule only latches if at least one member of the group passed, so that
+// an empty group does not latch before its endpoints have been added.
+func Latched(rule GroupRule) GroupRule {
+	latched := int32(0)
+	return func(passed, failed int) bool {
+		if atomic.LoadInt32(&latched) == 1 {
+			return true
+		}
+		if !rule(passed, failed) {
+			return false
+		}
+		if passed > 0 {
+			atomic.StoreInt32(&latched, 1)
+		}
+		return true
+	}
+}
+
+// InGroups adds an endpoint to the given groups. Groups do not need to be
+// registered before the endpoint is added.
+func InGroups(groups ...string) EndpointOption {
+	return func(ep *endpoint) {
+		ep.groups = append(ep.groups, groups...)
+	}
+}
+
+// Registers an aggregate endpoint for a group of endpoints.
+//
+// Requesting urlPath probes all endpoints of the given group like "/_ALL_".
+// The response code is StatusOK if the given rule passes. The groups
+// GroupLiveness, GroupReadiness and GroupStartup are registered by default.
+// Registering an existing group or an existing path panics.
+func (hc *HealthCheckServer) AddGroup(name string, urlPath string, rule GroupRule) {
+	hc.routeGuard.Lock()
+	defer hc.routeGuard.Unlock()
+
+	if _, exists := hc.groups[name]; exists {
+		panic(fmt.Sprintf(
+			"ERROR: Health check group \"%s\" already registered", name))
+	}
+	if err := hc.checkPath(urlPath, false); err != nil {
+		panic(err.Error())
+	}
+
+	hc.groups[name] = &group{
+		path: urlPath,
+		rule: rule,
+	}
+}
+
+// Changes the rule of a registered group.
+//
+// Setting the rule of a group that is not registered panics.
+func (hc *HealthCheckServer) SetGroupRule(name string, rule GroupRule) {
+	hc.routeGuard.Lock()
+	defer hc.routeGuard.Unlock()
+
+	grp, exists := hc.groups[name]
+	if !exists {
+		panic(fmt.Sprintf(
+			"ERROR: Health check group \"%s\" is not registered", name))
+	}
+	grp.rule = rule
+}
+
+// groupByPath returns the name and rule of the group served on the given
+// path. If no such group exists, the rule is nil. The routeGuard has to be
+// locked when calling this function.
+func (hc *HealthCheckServer) groupByPath(urlPath string) (string, GroupRule) {
+	for name, grp := range hc.groups {
+		if grp.path == urlPath {
+			return name, grp.rule
+		}
+	}
+	return "", nil
+}
+
+// sortedGroupPaths returns the paths of all groups in alphabetical order
+func (hc *HealthCheckServer) sortedGroupPaths() []string {
+	hc.routeGuard.RLock()
+	defer hc.routeGuard.RUnlock()
+
+	paths := make([]string, 0, len(hc.groups))
+	for _, grp := range hc.groups {
+		paths = append(paths, grp.path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Registers an aggregate endpoint with the default health check server.
+// See HealthCheckServer.AddGroup().
+func AddGroup(name string, urlPath string, rule GroupRule) {
+	defaultServer.AddGroup(name, urlPath, rule)
+}
+
+// Changes the rule of a group of the default health check server.
+// See HealthCheckServer.SetGroupRule().
+func SetGroupRule(name string, rule GroupRule) {
+	defaultServer.SetGroupRule(name, rule)
+}
@@ -0,0 +1,129 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package thealthcheck
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestHealthCheckGroups(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	hc := New("")
+
+	databaseCode, cacheCode := StatusServiceUnavailable, StatusOK
+	hc.AddEndpoint("/database", func() (int, string) {
+		return databaseCode, "database"
+	}, InGroups(GroupReadiness, GroupStartup))
+	hc.AddEndpoint("/cache", func() (int, string) {
+		return cacheCode, "cache"
+	}, InGroups(GroupReadiness, "optional"))
+	hc.AddEndpoint("/process", func() (int, string) {
+		return StatusOK, "process"
+	}, InGroups(GroupLiveness))
+
+	code, body := probe(hc, "/_LIVENESS_")
+	expect.Equal(StatusOK, code)
+	expect.Equal("/process 200 process\n", body)
+
+	code, body = probe(hc, "/_READINESS_")
+	expect.Equal(StatusServiceUnavailable, code)
+	expect.Equal("/cache 200 cache\n/database 503 database\n", body)
+
+	code, _ = probe(hc, "/_STARTUP_")
+	expect.Equal(StatusServiceUnavailable, code)
+
+	// Startup checks keep passing once they passed
+	databaseCode = StatusOK
+	code, _ = probe(hc, "/_STARTUP_")
+	expect.Equal(StatusOK, code)
+
+	databaseCode = StatusServiceUnavailable
+	code, _ = probe(hc, "/_STARTUP_")
+	expect.Equal(StatusOK, code)
+
+	// Custom groups and rules
+	hc.AddGroup("optional", "/_OPTIONAL_", AnyPassing)
+	cacheCode = StatusServiceUnavailable
+	code, body = probe(hc, "/_OPTIONAL_")
+	expect.Equal(StatusServiceUnavailable, code)
+	expect.Equal("/cache 503 cache\n", body)
+
+	hc.SetGroupRule(GroupReadiness, AnyPassing)
+	code, _ = probe(hc, "/_READINESS_")
+	expect.Equal(StatusServiceUnavailable, code)
+	databaseCode = StatusOK
+	code, _ = probe(hc, "/_READINESS_")
+	expect.Equal(StatusOK, code)
+
+	// Empty groups pass
+	hc.AddGroup("empty", "/_EMPTY_", AllPassing)
+	code, body = probe(hc, "/_EMPTY_")
+	expect.Equal(StatusOK, code)
+	expect.Equal("", body)
+
+	code, body = probe(hc, "/")
+	expect.Equal(http.StatusOK, code)
+	expect.Equal("/_ALL_\n/_EMPTY_\n/_LIVENESS_\n/_OPTIONAL_\n/_READINESS_\n/_STARTUP_\n/cache\n/database\n/process\n", body)
+}
+
+func TestHealthCheckGroupsLatchedEmpty(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	hc := New("")
+
+	// An empty startup group passes, but must not latch
+	code, _ := probe(hc, "/_STARTUP_")
+	expect.Equal(StatusOK, code)
+
+	startCode := StatusServiceUnavailable
+	hc.AddEndpoint("/start", func() (int, string) {
+		return startCode, "start"
+	}, InGroups(GroupStartup))
+
+	code, _ = probe(hc, "/_STARTUP_")
+	expect.Equal(StatusServiceUnavailable, code)
+
+	startCode = StatusOK
+	code, _ = probe(hc, "/_STARTUP_")
+	expect.Equal(StatusOK, code)
+
+	startCode = StatusServiceUnavailable
+	code, _ = probe(hc, "/_STARTUP_")
+	expect.Equal(StatusOK, code)
+}
+
+func TestHealthCheckGroupsInvalid(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	hc := New("")
+	callback := func() (int, string) { return StatusOK, "" }
+	hc.AddEndpoint("/foo", callback)
+
+	expectPanic := func(fn func()) {
+		panicked := func() (panicked bool) {
+			defer func() { panicked = recover() != nil }()
+			fn()
+			return false
+		}()
+		expect.True(panicked)
+	}
+
+	expectPanic(func() { hc.AddEndpoint("/_READINESS_", callback) })
+	expectPanic(func() { hc.AddGroup(GroupReadiness, "/_OTHER_", AllPassing) })
+	expectPanic(func() { hc.AddGroup("other", "/foo", AllPassing) })
+	expectPanic(func() { hc.AddGroup("other", "/_ALL_", AllPassing) })
+	expectPanic(func() { hc.SetGroupRule("unknown", AllPassing) })
+}
@@ -8,196 +8,632 @@
 // URL paths.
 //
 // GETing the "/" path provides a list of registered endpoints, one
-// per line. GETing "/_ALL_" probes each registered endpoint sequentially,
-// returning each endpoint's path, HTTP status code and body per line.
+// per line. GETing "/_ALL_" probes all registered endpoints in parallel,
+// returning each endpoint's path, HTTP status code and body per line,
+// sorted by path. Each probe is limited by a per-endpoint and an overall
+// timeout (see SetTimeouts). Expensive endpoints can be checked in the
+// background and serve their last result instead (see Cached).
 //
-// The package works as a "singleton" with just one server in order to
-// avoid cluttering the main program by passing handles around.
+// All endpoints can return JSON instead of plain text. The format is chosen
+// by the query parameter "format" ("json" or "text") or by the Accept
+// header of the request. Plain text is used by default.
+//
+// Callbacks for common checks are provided by TCPCheck, UnixSocketCheck,
+// HTTPCheck, DiskSpaceCheck, FileFreshnessCheck and MetricCheck.
+//
+// The last results of each endpoint are served on "/_HISTORY_" to show
+// flapping endpoints. Flapping can be damped by FlapDamping.
+//
+// Endpoints can depend on other endpoints and can be optional (see
+// DependsOn and Optional). Aggregate endpoints skip endpoints whose
+// dependencies failed and report "DEGRADED" instead of "FAILED" if only
+// optional endpoints failed.
+//
+// Endpoints can be added, replaced and removed at any time, including
+// while the server is running.
+//
+// Endpoints can be tagged with one or more groups, e.g. to separate
+// liveness, readiness and startup checks. Each group is served as an
+// aggregate endpoint like "/_ALL_" with its own rule for passing.
+//
+// Servers are created with New. The package level functions work on a
+// default server in order to avoid cluttering the main program by passing
+// handles around.
 package thealthcheck
 
 import (
-	"net/http"
-	"fmt"
 	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
 )
 
-//
 const (
-	StatusOK = http.StatusOK
+	StatusOK                 = http.StatusOK
 	StatusServiceUnavailable = http.StatusServiceUnavailable
+	// StatusDegraded is returned by default by aggregate endpoints if only
+	// optional endpoints failed. The service is considered to be available,
+	// so StatusOK is used and the degraded state is reported by the
+	// StatusHeader header. See SetDegradedCode.
+	StatusDegraded = http.StatusOK
+)
+
+const (
+	// ShutdownTimeout defines how long Stop waits for active requests to
+	// finish before closing their connections.
+	ShutdownTimeout = 5 * time.Second
+	// DefaultCheckTimeout is the default time a single endpoint callback
+	// may take before it is reported as unavailable.
+	DefaultCheckTimeout = 5 * time.Second
+	// DefaultProbeTimeout is the default time probing all endpoints via
+	// "/_ALL_" may take.
+	DefaultProbeTimeout = 10 * time.Second
 )
 
 // Code wishing to get probed by the health-checker needs to provide this callback
-type CallbackFunc func () (code int, body string)
+type CallbackFunc func() (code int, body string)
 
-// The HTTP server
-var server *http.Server
+// HealthCheckServer is a HTTP server serving a set of health check
+// endpoints. A server can be started and stopped multiple times.
+type HealthCheckServer struct {
+	// The address to listen on
+	listenAddr string
+	// List of endpoints known by the server
+	endpoints map[string]*endpoint
+	// List of aggregate groups known by the server
+	groups map[string]*group
+	// Guards endpoints and groups
+	routeGuard *sync.RWMutex
+	// Timeouts for single endpoints and for "/_ALL_"
+	checkTimeout time.Duration
+	probeTimeout time.Duration
+	// Response code of degraded aggregate endpoints
+	degradedCode int
+	// The HTTP server and its listener, set while running
+	server   *http.Server
+	listener net.Listener
+	// Set if Stop() has been called while the server was not running
+	stopped bool
+	guard   *sync.Mutex
+}
 
-// The HTTP request multiplexer
-var serveMux *http.ServeMux
+// The server used by the package level functions
+var defaultServer = New("")
 
-// List of endpoints known by the server
-var endpoints map[string]CallbackFunc
+// New creates a new health check server.
+//
+//	listenAddr: an address understood by net.Listen(), e.g. ":8008"
+func New(listenAddr string) *HealthCheckServer {
+	hc := &HealthCheckServer{
+		listenAddr:   listenAddr,
+		endpoints:    make(map[string]*endpoint),
+		groups:       make(map[string]*group),
+		routeGuard:   new(sync.RWMutex),
+		checkTimeout: DefaultCheckTimeout,
+		probeTimeout: DefaultProbeTimeout,
+		degradedCode: StatusDegraded,
+		guard:        new(sync.Mutex),
+	}
 
-// Init
-func init() {
-	// Create the request multiplexer
-	serveMux = http.NewServeMux()
-	// Initialize the endpoint list
-	endpoints = make(map[string]CallbackFunc)
+	// Add default groups
+	hc.AddGroup(GroupLiveness, "/_LIVENESS_", AllPassing)
+	hc.AddGroup(GroupReadiness, "/_READINESS_", AllPassing)
+	hc.AddGroup(GroupStartup, "/_STARTUP_", Latched(AllPassing))
+
+	return hc
 }
 
-// Configures the health check server
-//
-//  listenAddr: an address understood by http.ListenAndServe(), e.g. ":8008"
-func Configure(listenAddr string) {
-	// Create the HTTP server
-	server = &http.Server{
-		Addr:    listenAddr,
-		Handler: serveMux,
-	}
+// ServeHTTP implements the http.Handler interface. This allows to serve
+// the health checks from a custom HTTP server or a test server.
+func (hc *HealthCheckServer) ServeHTTP(responseWriter http.ResponseWriter, httpRequest *http.Request) {
+	urlPath := httpRequest.URL.Path
 
-	// Add default wildcard handler
-	serveMux.HandleFunc("/",
-		func(responseWriter http.ResponseWriter, httpRequest *http.Request) {
-			path := httpRequest.URL.Path
+	hc.routeGuard.RLock()
+	ep, isEndpoint := hc.endpoints[urlPath]
+	groupName, groupRule := hc.groupByPath(urlPath)
+	hc.routeGuard.RUnlock()
 
-			// Handle "/": list all our registered endpoints
-			if path == "/" {
-				fmt.Fprintf(responseWriter, "/_ALL_\n")
+	switch {
+	case urlPath == "/":
+		// Handle "/": list all our registered endpoints
+		hc.handleIndex(responseWriter)
 
-				// TBD: Collate
-				for endpointPath, _ := range endpoints {
-					fmt.Fprintf(responseWriter, "%s\n", endpointPath)
-				}
-				return
-			}
+	case urlPath == "/_ALL_":
+		// Handle magical "/_ALL_": probe all registered endpoints
+		hc.writeAggregate(responseWriter, httpRequest, hc.members(""), AllPassing)
 
-			// Default action: 404
-			responseWriter.WriteHeader(http.StatusNotFound)
-			fmt.Fprintf(responseWriter, "Path not found\n")
-			return
-		},
-	)
-
-	// Add magical "/_ALL" handler
-	serveMux.HandleFunc("/_ALL_",
-		func(responseWriter http.ResponseWriter, httpRequest *http.Request) {
-			// Response code needs to be set before writing the response body,
-			// so we need to pool the body temporarily into resultBody
-			var resultCode = StatusOK
-			var resultBody bytes.Buffer
-
-			// Call all endpoints sequentially
-			// (TBD: if there were _a lot_ of these we could do them in parallel)
-			// TBD: Collate (output at least)
-			for endpointPath, callback := range endpoints {
-				// Call the callback
-				code, body := callback()
-				// Append path, code, body to response body
-				fmt.Fprintf(&resultBody,
-					"%s %d %s\n",
-					endpointPath,
-					code,
-					body,
-				)
-
-				if code != StatusOK {
-					resultCode = StatusServiceUnavailable
-				}
-			}
+	case urlPath == "/_HISTORY_":
+		hc.handleHistory(responseWriter, httpRequest)
 
-			// Set HTTP response code
-			responseWriter.WriteHeader(resultCode)
+	case groupRule != nil:
+		hc.writeAggregate(responseWriter, httpRequest, hc.members(groupName), groupRule)
 
-			// Write HTTP response body
-			// (TBD: more efficient way, buffer -> writer?)
-			fmt.Fprintf(responseWriter, resultBody.String())
-		},
-	)
+	case isEndpoint:
+		// Call the callback
+		checkTimeout, _ := hc.timeouts()
+		result := ep.result(urlPath, checkTimeout)
+		writeResult(responseWriter, httpRequest, result)
+
+	default:
+		// Default action: 404
+		responseWriter.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(responseWriter, "Path not found\n")
+	}
 }
 
 // Registers an endpoint with the health checker.
 //
 // The urlPath must be unique. The callback must return an HTTP response code
-// and body text.
+// and body text. Options like InGroups() can be passed to further configure
+// the endpoint. Use SetEndpoint() to replace existing endpoints.
 //
 // Boilerplate:
 //
-//  healthcheck.AddEndpoint("/my/arbitrary/path" func()(code int, body string) {
-//      return 200, "Foobar Plugin is OK"
-//  })
+//	hc.AddEndpoint("/my/arbitrary/path" func()(code int, body string) {
+//	    return 200, "Foobar Plugin is OK"
+//	}, thealthcheck.InGroups(thealthcheck.GroupReadiness))
+func (hc *HealthCheckServer) AddEndpoint(urlPath string, callback CallbackFunc, options ...EndpointOption) {
+	hc.storeEndpoint(urlPath, callback, options, false)
+}
+
+// Registers or replaces an endpoint with the health checker.
 //
-func AddEndpoint(urlPath string, callback CallbackFunc){
+// This works like AddEndpoint() but replaces an existing endpoint of the
+// same path instead of panicking. The statistics of a replaced endpoint are
+// reset.
+func (hc *HealthCheckServer) SetEndpoint(urlPath string, callback CallbackFunc, options ...EndpointOption) {
+	hc.storeEndpoint(urlPath, callback, options, true)
+}
+
+// Removes an endpoint from the health checker.
+//
+// Background checks of the endpoint are stopped. Returns false if no
+// endpoint is registered for the given path.
+func (hc *HealthCheckServer) RemoveEndpoint(urlPath string) bool {
+	hc.routeGuard.Lock()
+	ep, exists := hc.endpoints[urlPath]
+	delete(hc.endpoints, urlPath)
+	hc.routeGuard.Unlock()
+
+	if exists {
+		ep.stopBackground()
+	}
+	return exists
+}
+
+func (hc *HealthCheckServer) storeEndpoint(urlPath string, callback CallbackFunc, options []EndpointOption, replace bool) {
+	ep := &endpoint{
+		callback:    callback,
+		historySize: DefaultHistorySize,
+		guard:       new(sync.Mutex),
+	}
+	for _, option := range options {
+		option(ep)
+	}
+
+	hc.routeGuard.Lock()
 	// Check parameters
+	err := hc.checkPath(urlPath, replace)
+	if err == nil {
+		err = ep.checkCache(urlPath)
+	}
+	if err == nil {
+		err = hc.checkDependencies(urlPath, ep)
+	}
+	if err != nil {
+		hc.routeGuard.Unlock()
+		panic(err.Error())
+	}
+
+	// Store the endpoint. Background checks are started while holding the
+	// lock so that a concurrent RemoveEndpoint or SetEndpoint cannot miss
+	// them.
+	previous := hc.endpoints[urlPath]
+	hc.endpoints[urlPath] = ep
+	if ep.interval > 0 {
+		ep.startBackground(urlPath, func() time.Duration {
+			checkTimeout, _ := hc.timeouts()
+			return checkTimeout
+		})
+	}
+	hc.routeGuard.Unlock()
+
+	if previous != nil {
+		previous.stopBackground()
+	}
+}
+
+// Registers an endpoint with the health checker.
+//
+// This is a convenience version of AddEndpoint() that takes
+// the urlPath's components as a list of strings and catenates
+// them.
+func (hc *HealthCheckServer) AddEndpointPathArray(urlPath []string, callback CallbackFunc, options ...EndpointOption) {
+	hc.AddEndpoint(joinPath(urlPath), callback, options...)
+}
+
+// checkPath returns an error if the given path cannot be used for an
+// endpoint. If replace is false, registered paths cannot be used either.
+// The routeGuard has to be locked when calling this function.
+func (hc *HealthCheckServer) checkPath(urlPath string, replace bool) error {
 	// -syntax
 	if len(urlPath) == 0 || urlPath[:1] != "/" || urlPath[len(urlPath)-1:] == "/" {
-		panic(fmt.Sprintf(
+		return fmt.Errorf(
 			"ERROR: Health check endpoint must begin and may not end with a slash: \"%s\"",
-			urlPath))
+			urlPath)
 	}
 	// - reserved paths
-	for _, path := range []string{"/", "/_ALL_"} {
+	for _, path := range hc.reservedPaths() {
 		if urlPath == path {
-			panic(fmt.Sprintf(
-				"ERROR: Health check path \"%s\" is reserved", path))
+			return fmt.Errorf(
+				"ERROR: Health check path \"%s\" is reserved", path)
 		}
 	}
 	// - registered paths
-	_, exists := endpoints[urlPath]
-	if exists {
-		panic(fmt.Sprintf(
-			"ERROR: Health check endpoint \"%s\" already registered", urlPath))
+	_, exists := hc.endpoints[urlPath]
+	if exists && !replace {
+		return fmt.Errorf(
+			"ERROR: Health check endpoint \"%s\" already registered", urlPath)
 	}
+	return nil
+}
 
-	// Register the HTTP route & handler
-	serveMux.HandleFunc(
-		urlPath,
-		func(responseWriter http.ResponseWriter, httpRequest *http.Request){
-			// Call the callback
-			code, body := callback()
-			// Set HTTP response code
-			responseWriter.WriteHeader(code)
-			// Write HTTP response body
-			fmt.Fprintf(responseWriter, body)
-			fmt.Fprintf(responseWriter, "\n")
-		},
-	)
+// reservedPaths returns the paths of all aggregate endpoints
+func (hc *HealthCheckServer) reservedPaths() []string {
+	paths := []string{"/", "/_ALL_", "/_HISTORY_"}
+	for _, grp := range hc.groups {
+		paths = append(paths, grp.path)
+	}
+	return paths
+}
 
-	// Store the endpoint
-	endpoints[urlPath] = callback
+// Sets the timeouts used when probing endpoints
+//
+// checkTimeout limits the time a single endpoint callback may take.
+// probeTimeout limits the time probing all endpoints via "/_ALL_" may take.
+// Endpoints exceeding a timeout are reported as unavailable. Their callbacks
+// are not interrupted but their results are discarded. While a callback is
+// still running, further probes of its endpoint wait for this callback
+// instead of calling it again. A timeout of 0 disables the respective limit.
+func (hc *HealthCheckServer) SetTimeouts(checkTimeout, probeTimeout time.Duration) {
+	hc.guard.Lock()
+	hc.checkTimeout = checkTimeout
+	hc.probeTimeout = probeTimeout
+	hc.guard.Unlock()
 }
 
-// Registers an endpoint with the health checker.
+// Sets the response code of degraded aggregate endpoints
+//
+// Aggregate endpoints are degraded if only optional endpoints failed (see
+// Optional). StatusDegraded, i.e. StatusOK, is used by default so that load
+// balancers keep using degraded services. Clients can tell degraded and
+// healthy services apart by the StatusHeader header. Set a different code
+// if clients only look at the response code, e.g. StatusServiceUnavailable
+// to report degraded services as failed.
+func (hc *HealthCheckServer) SetDegradedCode(code int) {
+	hc.guard.Lock()
+	hc.degradedCode = code
+	hc.guard.Unlock()
+}
+
+// Starts the HTTP server
+//
+// This function blocks until the server is stopped. If the server has been
+// stopped by Stop(), nil is returned. Otherwise the error that caused the
+// server to stop is returned.
+// If Stop() has been called before the server was started, Start returns nil
+// without starting the server. This makes sure that calling Start in a
+// separate go routine and calling Stop right afterwards stops the server.
+func (hc *HealthCheckServer) Start() error {
+	hc.guard.Lock()
+	if hc.server != nil {
+		hc.guard.Unlock()
+		return fmt.Errorf("Health check server on %s is already running", hc.listenAddr)
+	}
+	if hc.stopped {
+		hc.stopped = false
+		hc.guard.Unlock()
+		return nil // ### return, stopped before start ###
+	}
+
+	listener, err := net.Listen("tcp", hc.listenAddr)
+	if err != nil {
+		hc.guard.Unlock()
+		return err
+	}
+
+	server := &http.Server{
+		Handler: hc,
+	}
+	hc.server = server
+	hc.listener = listener
+	hc.guard.Unlock()
+
+	err = server.Serve(listener)
+
+	hc.guard.Lock()
+	if hc.server == server {
+		hc.server = nil
+		hc.listener = nil
+	}
+	hc.guard.Unlock()
+
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Stops the HTTP server
+//
+// Active requests are given ShutdownTimeout to finish. Stopping a server
+// that is not running cancels the next call to Start().
+func (hc *HealthCheckServer) Stop() error {
+	hc.guard.Lock()
+	server := hc.server
+	hc.server = nil
+	hc.listener = nil
+	hc.stopped = server == nil
+	hc.guard.Unlock()
+
+	if server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	return server.Shutdown(ctx)
+}
+
+// Stops the HTTP server and all background checks
+//
+// Background checks are not restarted by Start(). Cached endpoints call
+// their callback for each request instead.
+func (hc *HealthCheckServer) Close() error {
+	for _, member := range hc.members("") {
+		member.ep.stopBackground()
+	}
+	return hc.Stop()
+}
+
+// Addr returns the address the server is listening on or nil if the server
+// is not running. This is useful if the server has been created with a port
+// of 0.
+func (hc *HealthCheckServer) Addr() net.Addr {
+	hc.guard.Lock()
+	defer hc.guard.Unlock()
+
+	if hc.listener == nil {
+		return nil
+	}
+	return hc.listener.Addr()
+}
+
+// Handle "/": list all our registered endpoints
+func (hc *HealthCheckServer) handleIndex(responseWriter http.ResponseWriter) {
+	fmt.Fprintf(responseWriter, "/_ALL_\n")
+
+	for _, groupPath := range hc.sortedGroupPaths() {
+		fmt.Fprintf(responseWriter, "%s\n", groupPath)
+	}
+	for _, member := range hc.members("") {
+		fmt.Fprintf(responseWriter, "%s\n", member.path)
+	}
+}
+
+// writeAggregate probes the given endpoints and writes their results. The
+// response code is StatusServiceUnavailable if the given rule fails for the
+// critical endpoints.
+func (hc *HealthCheckServer) writeAggregate(responseWriter http.ResponseWriter, httpRequest *http.Request, members []namedEndpoint, rule GroupRule) {
+	// Call all endpoints in parallel
+	results := hc.probe(members)
+
+	hc.guard.Lock()
+	degradedCode := hc.degradedCode
+	hc.guard.Unlock()
+
+	resultCode, status := aggregateStatus(results, rule, degradedCode)
+	writeResults(responseWriter, httpRequest, resultCode, status, results)
+}
+
+// checkResult holds the result of a single endpoint callback along with the
+// statistics of the endpoint
+type checkResult struct {
+	path        string
+	code        int
+	body        string
+	duration    time.Duration
+	lastSuccess time.Time
+	failures    int
+	optional    bool
+	skipped     bool
+}
+
+// namedEndpoint is an endpoint along with its path
+type namedEndpoint struct {
+	path string
+	ep   *endpoint
+}
+
+// probe calls the callbacks of the given endpoints in parallel and returns
+// their results in the same order. Each callback is limited by the check
+// timeout and by the probe timeout. Endpoints wait for their dependencies
+// and are skipped if a dependency failed.
+func (hc *HealthCheckServer) probe(members []namedEndpoint) []checkResult {
+	checkTimeout, probeTimeout := hc.timeouts()
+	deadline := time.Now().Add(probeTimeout)
+	results := make([]checkResult, len(members))
+	done := make([]chan struct{}, len(members))
+	index := make(map[string]int, len(members))
+
+	for i, member := range members {
+		done[i] = make(chan struct{})
+		index[member.path] = i
+	}
+
+	var wg sync.WaitGroup
+	for i, member := range members {
+		wg.Add(1)
+		go func(i int, endpointPath string, ep *endpoint) {
+			defer wg.Done()
+			defer close(done[i])
+
+			// Critical failures take precedence over optional ones
+			failed, failedOptional := "", true
+			for _, dependency := range ep.dependencies {
+				j, exists := index[dependency]
+				if !exists {
+					continue // ### continue, not probed ###
+				}
+				<-done[j]
+				if results[j].code != StatusOK && (failed == "" || (failedOptional && !results[j].optional)) {
+					failed, failedOptional = dependency, results[j].optional
+				}
+			}
+			if failed != "" {
+				results[i] = ep.skip(endpointPath, failed, failedOptional)
+				return // ### return, dependency failed ###
+			}
+
+			timeout := checkTimeout
+			if remaining := deadline.Sub(time.Now()); probeTimeout > 0 && (timeout <= 0 || remaining < timeout) {
+				timeout = remaining
+				if timeout <= 0 {
+					timeout = time.Nanosecond
+				}
+			}
+			results[i] = ep.result(endpointPath, timeout)
+		}(i, member.path, member.ep)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// timeouts returns the current check and probe timeouts
+func (hc *HealthCheckServer) timeouts() (checkTimeout, probeTimeout time.Duration) {
+	hc.guard.Lock()
+	defer hc.guard.Unlock()
+	return hc.checkTimeout, hc.probeTimeout
+}
+
+// members returns all endpoints of the given group sorted by path. If no
+// group is given, all endpoints are returned.
+func (hc *HealthCheckServer) members(groupName string) []namedEndpoint {
+	hc.routeGuard.RLock()
+	defer hc.routeGuard.RUnlock()
+
+	members := make([]namedEndpoint, 0, len(hc.endpoints))
+	for endpointPath, ep := range hc.endpoints {
+		if groupName == "" || ep.inGroup(groupName) {
+			members = append(members, namedEndpoint{endpointPath, ep})
+		}
+	}
+	sort.Sort(namedEndpointsByPath(members))
+	return members
+}
+
+type namedEndpointsByPath []namedEndpoint
+
+func (s namedEndpointsByPath) Len() int {
+	return len(s)
+}
+
+func (s namedEndpointsByPath) Less(i, j int) bool {
+	return s[i].path < s[j].path
+}
+
+func (s namedEndpointsByPath) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Configures the default health check server
+//
+//	listenAddr: an address understood by net.Listen(), e.g. ":8008"
+func Configure(listenAddr string) {
+	defaultServer.guard.Lock()
+	defaultServer.listenAddr = listenAddr
+	defaultServer.guard.Unlock()
+}
+
+// Registers an endpoint with the default health check server.
+// See HealthCheckServer.AddEndpoint().
+//
+// Boilerplate:
+//
+//	healthcheck.AddEndpoint("/my/arbitrary/path" func()(code int, body string) {
+//	    return 200, "Foobar Plugin is OK"
+//	})
+func AddEndpoint(urlPath string, callback CallbackFunc, options ...EndpointOption) {
+	defaultServer.AddEndpoint(urlPath, callback, options...)
+}
+
+// Registers an endpoint with the default health check server.
 //
 // This is a convenience version of AddEndpoint() that takes
 // the urlPath's components as a list of strings and catenates
 // them.
-func AddEndpointPathArray(urlPath []string, callback CallbackFunc) {
-	// Catenate path
-	var cat bytes.Buffer
-	for _, pathComponent := range urlPath {
-		fmt.Fprintf(&cat, "/%s", pathComponent)
-	}
-	// Call it
-	AddEndpoint(cat.String(), callback)
+func AddEndpointPathArray(urlPath []string, callback CallbackFunc, options ...EndpointOption) {
+	defaultServer.AddEndpointPathArray(urlPath, callback, options...)
 }
 
-// Starts the HTTP server
+// Sets the timeouts of the default health check server
+//
+// See HealthCheckServer.SetTimeouts().
+func SetTimeouts(checkTimeout, probeTimeout time.Duration) {
+	defaultServer.SetTimeouts(checkTimeout, probeTimeout)
+}
+
+// Sets the response code of degraded aggregate endpoints of the default
+// server.
+// See HealthCheckServer.SetDegradedCode().
+func SetDegradedCode(code int) {
+	defaultServer.SetDegradedCode(code)
+}
+
+// Starts the default HTTP server
 //
 // Call this after Configure() and AddEndpoint() calls.
+// See HealthCheckServer.Start().
+func Start() error {
+	return defaultServer.Start()
+}
+
+// Stops the default HTTP server
 //
-// TBD: is it possible to AddEndpoint() after Start()ing?
-func Start(){
-	err := server.ListenAndServe()
+// See HealthCheckServer.Stop().
+func Stop() error {
+	return defaultServer.Stop()
+}
 
-	if err != nil {
-		panic(err.Error())
-	}
+// Registers or replaces an endpoint with the default health check server.
+// See HealthCheckServer.SetEndpoint().
+func SetEndpoint(urlPath string, callback CallbackFunc, options ...EndpointOption) {
+	defaultServer.SetEndpoint(urlPath, callback, options...)
 }
 
-// TBD: Cleanup?
-func Stop(){
+// Removes an endpoint from the default health check server.
+// See HealthCheckServer.RemoveEndpoint().
+func RemoveEndpoint(urlPath string) bool {
+	return defaultServer.RemoveEndpoint(urlPath)
+}
 
+// Stops the default HTTP server and all background checks
+//
+// See HealthCheckServer.Close().
+func Close() error {
+	return defaultServer.Close()
+}
 
+// joinPath catenates the given path components to an URL path
+func joinPath(urlPath []string) string {
+	var cat bytes.Buffer
+	for _, pathComponent := range urlPath {
+		fmt.Fprintf(&cat, "/%s", pathComponent)
+	}
+	return cat.String()
 }
@@ -0,0 +1,309 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package thealthcheck
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func probe(hc *HealthCheckServer, path string) (int, string) {
+	recorder := httptest.NewRecorder()
+	hc.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+	return recorder.Code, recorder.Body.String()
+}
+
+func TestHealthCheckServerEndpoints(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	hc := New("")
+
+	hc.AddEndpoint("/foo", func() (int, string) {
+		return StatusOK, "foo is %s OK"
+	})
+	hc.AddEndpointPathArray([]string{"bar", "baz"}, func() (int, string) {
+		return StatusServiceUnavailable, "baz is down"
+	})
+
+	code, body := probe(hc, "/foo")
+	expect.Equal(StatusOK, code)
+	expect.Equal("foo is %s OK\n", body)
+
+	code, body = probe(hc, "/bar/baz")
+	expect.Equal(StatusServiceUnavailable, code)
+	expect.Equal("baz is down\n", body)
+
+	code, body = probe(hc, "/_ALL_")
+	expect.Equal(StatusServiceUnavailable, code)
+	expect.Contains(body, "/foo 200 foo is %s OK\n")
+	expect.Contains(body, "/bar/baz 503 baz is down\n")
+
+	code, body = probe(hc, "/")
+	expect.Equal(StatusOK, code)
+	expect.Contains(body, "/_ALL_\n")
+	expect.Contains(body, "/foo\n")
+
+	code, _ = probe(hc, "/unknown")
+	expect.Equal(http.StatusNotFound, code)
+
+	// Servers do not share endpoints
+	code, _ = probe(New(""), "/foo")
+	expect.Equal(http.StatusNotFound, code)
+}
+
+func TestHealthCheckServerInvalidEndpoints(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	hc := New("")
+	callback := func() (int, string) { return StatusOK, "" }
+	hc.AddEndpoint("/foo", callback)
+
+	for _, path := range []string{"", "foo", "/foo/", "/", "/_ALL_", "/foo"} {
+		panicked := func() (panicked bool) {
+			defer func() { panicked = recover() != nil }()
+			hc.AddEndpoint(path, callback)
+			return false
+		}()
+		expect.True(panicked)
+	}
+}
+
+func TestHealthCheckServerSetRemoveEndpoint(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	hc := New("")
+
+	hc.SetEndpoint("/foo", func() (int, string) {
+		return StatusServiceUnavailable, "foo is down"
+	}, InGroups(GroupReadiness))
+
+	code, _ := probe(hc, "/_READINESS_")
+	expect.Equal(StatusServiceUnavailable, code)
+
+	// Replace the endpoint and its groups
+	hc.SetEndpoint("/foo", func() (int, string) {
+		return StatusOK, "foo is up"
+	})
+
+	code, body := probe(hc, "/foo")
+	expect.Equal(StatusOK, code)
+	expect.Equal("foo is up\n", body)
+
+	code, body = probe(hc, "/_READINESS_")
+	expect.Equal(StatusOK, code)
+	expect.Equal("", body)
+
+	// Remove the endpoint
+	expect.True(hc.RemoveEndpoint("/foo"))
+	expect.False(hc.RemoveEndpoint("/foo"))
+
+	code, _ = probe(hc, "/foo")
+	expect.Equal(http.StatusNotFound, code)
+
+	code, body = probe(hc, "/")
+	expect.Equal(StatusOK, code)
+	expect.False(strings.Contains(body, "/foo\n"))
+
+	// Removed paths can be added again
+	hc.AddEndpoint("/foo", func() (int, string) {
+		return StatusOK, "foo is back"
+	})
+	code, body = probe(hc, "/foo")
+	expect.Equal(StatusOK, code)
+	expect.Equal("foo is back\n", body)
+}
+
+func TestHealthCheckServerConcurrentChanges(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	hc := New("")
+	callback := func() (int, string) { return StatusOK, "OK" }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path := fmt.Sprintf("/check%d", i)
+			for j := 0; j < 50; j++ {
+				hc.SetEndpoint(path, callback, InGroups(GroupLiveness))
+				probe(hc, path)
+				probe(hc, "/_ALL_")
+				probe(hc, "/_LIVENESS_")
+				hc.RemoveEndpoint(path)
+			}
+		}(i)
+	}
+
+	expect.NonBlocking(5*time.Second, wg.Wait)
+
+	code, body := probe(hc, "/_ALL_")
+	expect.Equal(StatusOK, code)
+	expect.Equal("", body)
+}
+
+func TestHealthCheckServerStartStop(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	hc := New("127.0.0.1:0")
+	hc.AddEndpoint("/foo", func() (int, string) {
+		return StatusOK, "OK"
+	})
+
+	expect.NoError(hc.Stop())
+	expect.Nil(hc.Addr())
+
+	// Stopping a server before it has been started cancels the start
+	expect.NonBlocking(time.Second, func() {
+		expect.NoError(hc.Start())
+	})
+	expect.Nil(hc.Addr())
+
+	// Servers can be restarted
+	for i := 0; i < 2; i++ {
+		result := make(chan error, 1)
+		go func() {
+			result <- hc.Start()
+		}()
+
+		var addr string
+		expect.NonBlocking(time.Second, func() {
+			for hc.Addr() == nil {
+				time.Sleep(time.Millisecond)
+			}
+			addr = hc.Addr().String()
+		})
+
+		response, err := http.Get("http://" + addr + "/foo")
+		if expect.NoError(err) {
+			body, _ := ioutil.ReadAll(response.Body)
+			response.Body.Close()
+			expect.Equal(StatusOK, response.StatusCode)
+			expect.Equal("OK\n", string(body))
+		}
+
+		expect.NoError(hc.Stop())
+		expect.NonBlocking(time.Second, func() {
+			expect.NoError(<-result)
+		})
+		expect.Nil(hc.Addr())
+	}
+
+	// Start returns listen errors
+	blocker := New("127.0.0.1:0")
+	result := make(chan error, 1)
+	go func() {
+		result <- blocker.Start()
+	}()
+	expect.NonBlocking(time.Second, func() {
+		for blocker.Addr() == nil {
+			time.Sleep(time.Millisecond)
+		}
+	})
+	defer blocker.Stop()
+
+	expect.NotNil(New(blocker.Addr().String()).Start())
+	expect.NotNil(blocker.Start())
+}
+
+func TestHealthCheckServerTimeouts(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	hc := New("")
+	hc.SetTimeouts(50*time.Millisecond, 100*time.Millisecond)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	hc.AddEndpoint("/c/hanging", func() (int, string) {
+		<-release
+		return StatusOK, "too late"
+	})
+	hc.AddEndpoint("/b/slow", func() (int, string) {
+		time.Sleep(30 * time.Millisecond)
+		return StatusOK, "slow"
+	})
+	hc.AddEndpoint("/a/fast", func() (int, string) {
+		return StatusOK, "fast"
+	})
+
+	// Checks run in parallel and hanging checks are reported as unavailable
+	start := time.Now()
+	code, body := probe(hc, "/_ALL_")
+	// Running sequentially would take at least 80ms
+	expect.True(time.Since(start) < 80*time.Millisecond)
+	expect.Equal(StatusServiceUnavailable, code)
+	expect.Equal("/a/fast 200 fast\n"+
+		"/b/slow 200 slow\n"+
+		"/c/hanging 503 Health check timed out after 50ms\n", body)
+
+	code, body = probe(hc, "/c/hanging")
+	expect.Equal(StatusServiceUnavailable, code)
+	expect.Equal("Health check timed out after 50ms\n", body)
+
+	// The overall timeout limits all checks
+	hc.SetTimeouts(0, 20*time.Millisecond)
+	code, body = probe(hc, "/_ALL_")
+	expect.Equal(StatusServiceUnavailable, code)
+	expect.Contains(body, "/a/fast 200 fast\n")
+	expect.Contains(body, "/b/slow 503 Health check timed out after")
+
+	code, body = probe(hc, "/")
+	expect.Equal(StatusOK, code)
+	expect.Equal("/_ALL_\n/_LIVENESS_\n/_READINESS_\n/_STARTUP_\n/a/fast\n/b/slow\n/c/hanging\n", body)
+}
+
+func TestHealthCheckServerHangingCheck(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	hc := New("")
+	hc.SetTimeouts(10*time.Millisecond, 0)
+
+	calls := int32(0)
+	release := make(chan struct{})
+	hc.AddEndpoint("/hanging", func() (int, string) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-release
+			return StatusServiceUnavailable, "released"
+		}
+		return StatusOK, "fresh"
+	})
+
+	// Probes do not start another callback while the first one is running
+	for i := 0; i < 5; i++ {
+		code, body := probe(hc, "/hanging")
+		expect.Equal(StatusServiceUnavailable, code)
+		expect.Equal("Health check timed out after 10ms\n", body)
+	}
+	expect.Equal(int32(1), atomic.LoadInt32(&calls))
+
+	// Probes without a timeout wait for the running callback
+	hc.SetTimeouts(0, 0)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+	code, body := probe(hc, "/hanging")
+	expect.Equal(StatusServiceUnavailable, code)
+	expect.Equal("released\n", body)
+	expect.Equal(int32(1), atomic.LoadInt32(&calls))
+
+	code, body = probe(hc, "/hanging")
+	expect.Equal(StatusOK, code)
+	expect.Equal("fresh\n", body)
+	expect.Equal(int32(2), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,181 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package thealthcheck
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DefaultHistorySize is the number of results kept per endpoint unless
+// configured otherwise by KeepHistory.
+const DefaultHistorySize = 20
+
+// historyTimeFormat is used to print history entries as text
+const historyTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// historyEntry holds a single result of an endpoint's callback
+type historyEntry struct {
+	time     time.Time
+	code     int
+	body     string
+	duration time.Duration
+}
+
+// jsonHistory is the JSON representation of an endpoint's history
+type jsonHistory struct {
+	Path    string             `json:"path"`
+	Changes int                `json:"changes"`
+	Results []jsonHistoryEntry `json:"results"`
+}
+
+type jsonHistoryEntry struct {
+	Time       time.Time `json:"time"`
+	Status     string    `json:"status"`
+	Code       int       `json:"code"`
+	Message    string    `json:"message"`
+	DurationMs float64   `json:"durationMs"`
+}
+
+// KeepHistory sets the number of results kept for an endpoint. The history
+// is served on "/_HISTORY_". A size of 0 disables the history.
+func KeepHistory(size int) EndpointOption {
+	return func(ep *endpoint) {
+		ep.historySize = size
+	}
+}
+
+// FlapDamping changes the state of an endpoint only after the given number
+// of consecutive results agree on the new state, i.e. they all pass or all
+// fail. Until then, the response code of the previous state is returned
+// and the body notes the pending change. The first result always sets the
+// state. The history and the endpoint statistics are not damped.
+func FlapDamping(results int) EndpointOption {
+	return func(ep *endpoint) {
+		ep.damping = results
+	}
+}
+
+// record adds a result to the history and applies flap damping to it. The
+// endpoint's guard has to be locked when calling this function.
+func (ep *endpoint) record(result *checkResult, start time.Time) {
+	if ep.historySize > 0 {
+		if len(ep.history) >= ep.historySize {
+			ep.history = append(ep.history[:0], ep.history[len(ep.history)-ep.historySize+1:]...)
+		}
+		ep.history = append(ep.history, historyEntry{
+			time:     start,
+			code:     result.code,
+			body:     result.body,
+			duration: result.duration,
+		})
+	}
+
+	passing := result.code == StatusOK
+	switch {
+	case ep.stableCode == 0 || ep.damping <= 1 || passing == (ep.stableCode == StatusOK):
+		ep.stableCode = result.code
+		ep.pending = 0
+
+	case ep.pending+1 >= ep.damping:
+		ep.stableCode = result.code
+		ep.pending = 0
+
+	default:
+		ep.pending++
+		result.body = fmt.Sprintf("%s (state change pending, %d of %d results)", result.body, ep.pending, ep.damping)
+		result.code = ep.stableCode
+	}
+}
+
+// historySnapshot returns a copy of the endpoint's history
+func (ep *endpoint) historySnapshot() []historyEntry {
+	ep.guard.Lock()
+	defer ep.guard.Unlock()
+	return append([]historyEntry{}, ep.history...)
+}
+
+// countChanges returns how often the given history switched between passing
+// and failing.
+func countChanges(history []historyEntry) int {
+	changes := 0
+	for i := 1; i < len(history); i++ {
+		if (history[i].code == StatusOK) != (history[i-1].code == StatusOK) {
+			changes++
+		}
+	}
+	return changes
+}
+
+// Handle "/_HISTORY_": list the history of all endpoints or, if the query
+// parameter "path" is set, of the given endpoint only.
+func (hc *HealthCheckServer) handleHistory(responseWriter http.ResponseWriter, httpRequest *http.Request) {
+	members := hc.members("")
+	if path := httpRequest.URL.Query().Get("path"); path != "" {
+		filtered := []namedEndpoint{}
+		for _, member := range members {
+			if member.path == path {
+				filtered = append(filtered, member)
+			}
+		}
+		if len(filtered) == 0 {
+			responseWriter.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(responseWriter, "Path not found\n")
+			return // ### return, unknown endpoint ###
+		}
+		members = filtered
+	}
+
+	if wantsJSON(httpRequest) {
+		histories := make([]jsonHistory, 0, len(members))
+		for _, member := range members {
+			history := member.ep.historySnapshot()
+			converted := jsonHistory{
+				Path:    member.path,
+				Changes: countChanges(history),
+				Results: make([]jsonHistoryEntry, 0, len(history)),
+			}
+			for _, entry := range history {
+				converted.Results = append(converted.Results, jsonHistoryEntry{
+					Time:       entry.time,
+					Status:     statusText(entry.code),
+					Code:       entry.code,
+					Message:    entry.body,
+					DurationMs: float64(entry.duration) / float64(time.Millisecond),
+				})
+			}
+			histories = append(histories, converted)
+		}
+		writeJSON(responseWriter, StatusOK, histories)
+		return
+	}
+
+	var resultBody bytes.Buffer
+	for _, member := range members {
+		for _, entry := range member.ep.historySnapshot() {
+			// Append path, time, code, body to response body
+			fmt.Fprintf(&resultBody,
+				"%s %s %d %s\n",
+				member.path,
+				entry.time.Format(historyTimeFormat),
+				entry.code,
+				entry.body,
+			)
+		}
+	}
+	resultBody.WriteTo(responseWriter)
+}
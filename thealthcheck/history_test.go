@@ -0,0 +1,127 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package thealthcheck
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestHealthCheckHistory(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	hc := New("")
+
+	codes := []int{StatusOK, StatusServiceUnavailable, StatusOK, StatusOK}
+	calls := 0
+	hc.AddEndpoint("/foo", func() (int, string) {
+		code := codes[calls%len(codes)]
+		calls++
+		return code, "foo"
+	}, KeepHistory(3))
+	hc.AddEndpoint("/bar", func() (int, string) {
+		return StatusOK, "bar"
+	}, KeepHistory(0))
+
+	for range codes {
+		probe(hc, "/foo")
+	}
+	probe(hc, "/bar")
+
+	code, body := probe(hc, "/_HISTORY_")
+	expect.Equal(StatusOK, code)
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	if expect.Equal(3, len(lines)) {
+		expect.True(strings.HasPrefix(lines[0], "/foo "))
+		expect.True(strings.HasSuffix(lines[0], " 503 foo"))
+		expect.True(strings.HasSuffix(lines[2], " 200 foo"))
+	}
+
+	code, body = probe(hc, "/_HISTORY_?path=/foo&format=json")
+	expect.Equal(StatusOK, code)
+
+	histories := []jsonHistory{}
+	expect.NoError(json.Unmarshal([]byte(body), &histories))
+	if expect.Equal(1, len(histories)) {
+		expect.Equal("/foo", histories[0].Path)
+		expect.Equal(1, histories[0].Changes)
+		if expect.Equal(3, len(histories[0].Results)) {
+			expect.Equal(StatusTextFailed, histories[0].Results[0].Status)
+			expect.Equal(StatusServiceUnavailable, histories[0].Results[0].Code)
+		}
+	}
+
+	code, _ = probe(hc, "/_HISTORY_?path=/unknown")
+	expect.Equal(http.StatusNotFound, code)
+
+	panicked := func() (panicked bool) {
+		defer func() { panicked = recover() != nil }()
+		hc.AddEndpoint("/_HISTORY_", func() (int, string) { return StatusOK, "" })
+		return false
+	}()
+	expect.True(panicked)
+}
+
+func TestHealthCheckFlapDamping(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	hc := New("")
+
+	fooCode := StatusOK
+	hc.AddEndpoint("/foo", func() (int, string) {
+		return fooCode, "foo"
+	}, FlapDamping(3))
+
+	code, body := probe(hc, "/foo")
+	expect.Equal(StatusOK, code)
+	expect.Equal("foo\n", body)
+
+	// Single failures are damped
+	fooCode = StatusServiceUnavailable
+	code, body = probe(hc, "/foo")
+	expect.Equal(StatusOK, code)
+	expect.Equal("foo (state change pending, 1 of 3 results)\n", body)
+
+	fooCode = StatusOK
+	code, body = probe(hc, "/foo")
+	expect.Equal(StatusOK, code)
+	expect.Equal("foo\n", body)
+
+	// Consecutive failures change the state
+	fooCode = StatusServiceUnavailable
+	probe(hc, "/foo")
+	code, _ = probe(hc, "/foo")
+	expect.Equal(StatusOK, code)
+	code, body = probe(hc, "/foo")
+	expect.Equal(StatusServiceUnavailable, code)
+	expect.Equal("foo\n", body)
+
+	// Recovering is damped, too
+	fooCode = StatusOK
+	code, body = probe(hc, "/foo")
+	expect.Equal(StatusServiceUnavailable, code)
+	expect.Equal("foo (state change pending, 1 of 3 results)\n", body)
+
+	// The history keeps the actual results
+	code, body = probe(hc, "/_HISTORY_?path=/foo&format=json")
+	histories := []jsonHistory{}
+	expect.NoError(json.Unmarshal([]byte(body), &histories))
+	if expect.Equal(1, len(histories)) {
+		expect.Equal(4, histories[0].Changes)
+		expect.Equal(7, len(histories[0].Results))
+	}
+}
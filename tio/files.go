@@ -131,3 +131,39 @@ func FileCRC32(path string) (uint32, error) {
 	}
 	return crc32.ChecksumIEEE(data), nil
 }
+
+// WriteFileAtomic writes data to a temporary file in the directory of
+// filePath and renames it to filePath afterwards. Readers of filePath will
+// either see the previous or the new content but never a partially written
+// file.
+func WriteFileAtomic(filePath string, data []byte, perm os.FileMode) error {
+	dir, base := filepath.Split(filePath)
+	if dir == "" {
+		dir = "."
+	}
+
+	file, err := ioutil.TempFile(dir, "."+base+".")
+	if err != nil {
+		return err
+	}
+	tempPath := file.Name()
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tempPath, perm)
+	}
+	if err == nil {
+		err = os.Rename(tempPath, filePath)
+	}
+
+	if err != nil {
+		os.Remove(tempPath)
+	}
+	return err
+}
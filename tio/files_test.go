@@ -16,7 +16,9 @@ package tio
 
 import (
 	"github.com/trivago/tgo/ttesting"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sort"
 	"testing"
 	"time"
@@ -149,3 +151,30 @@ func TestCommonPath(t *testing.T) {
 	common = CommonPath("a/b/c", "a/b/d")
 	expect.Equal("a/b", common)
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "tio")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	filePath := filepath.Join(dir, "data.txt")
+	expect.NoError(WriteFileAtomic(filePath, []byte("first"), 0644))
+	expect.NoError(WriteFileAtomic(filePath, []byte("second"), 0600))
+
+	data, err := ioutil.ReadFile(filePath)
+	expect.NoError(err)
+	expect.Equal("second", string(data))
+
+	stat, err := os.Stat(filePath)
+	expect.NoError(err)
+	expect.Equal(os.FileMode(0600), stat.Mode().Perm())
+
+	files, err := ioutil.ReadDir(dir)
+	expect.NoError(err)
+	expect.Equal(1, len(files))
+
+	err = WriteFileAtomic(filepath.Join(dir, "missing", "data.txt"), []byte("data"), 0644)
+	expect.NotNil(err)
+}
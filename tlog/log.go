@@ -56,12 +56,14 @@ var (
 
 // LogScope allows to wrap the standard Error, Warning, Note and Debug loggers
 // into a scope, i.e. all messages written to this logger are prefixed.
+// Structured loggers created by With add the scope as field instead.
 type LogScope struct {
 	Error   *log.Logger
 	Warning *log.Logger
 	Note    *log.Logger
 	Debug   *log.Logger
 	name    string
+	scope   Field
 }
 
 // NewLogScope creates a new LogScope with the given prefix string.
@@ -70,6 +72,7 @@ func NewLogScope(name string) LogScope {
 
 	return LogScope{
 		name:    name,
+		scope:   String("scope", name),
 		Error:   log.New(logLogger{Error}, scopeMarker, 0),
 		Warning: log.New(logLogger{Warning}, scopeMarker, 0),
 		Note:    log.New(logLogger{Note}, scopeMarker, 0),
@@ -83,6 +86,7 @@ func (scope *LogScope) NewSubScope(name string) LogScope {
 
 	return LogScope{
 		name:    name,
+		scope:   String("scope", scope.name+"."+name),
 		Error:   log.New(logLogger{Error}, scopeMarker, 0),
 		Warning: log.New(logLogger{Warning}, scopeMarker, 0),
 		Note:    log.New(logLogger{Note}, scopeMarker, 0),
@@ -90,6 +94,12 @@ func (scope *LogScope) NewSubScope(name string) LogScope {
 	}
 }
 
+// With creates a structured logger for this scope. The name of the scope is
+// added as field "scope", followed by the given fields.
+func (scope *LogScope) With(fields ...Field) Logger {
+	return Logger{[]Field{scope.scope}}.With(fields...)
+}
+
 func init() {
 	log.SetFlags(0)
 	log.SetOutput(logEnabled)
@@ -100,6 +110,7 @@ func init() {
 // High level verobosities contain lower levels, i.e. log level warning will
 // contain error messages, too.
 func SetVerbosity(loglevel Verbosity) {
+	verbosity = loglevel
 	Error = log.New(logDisabled, "", 0)
 	Warning = log.New(logDisabled, "", 0)
 	Note = log.New(logDisabled, "", 0)
@@ -0,0 +1,146 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry holds a structured log message passed to an Encoder
+type Entry struct {
+	Time    time.Time
+	Level   Verbosity
+	Message string
+	Fields  []Field
+}
+
+// Encoder formats structured log messages. Encode is called once per
+// message with an empty buffer and must write the encoded message to this
+// buffer. A trailing newline is not required.
+type Encoder interface {
+	Encode(buffer *bytes.Buffer, entry Entry)
+}
+
+// LogfmtEncoder writes messages as space separated key=value pairs, e.g.
+//
+//	time=2018-01-02T15:04:05Z level=error msg="Connect failed" scope=kafka offset=42
+//
+// Values containing spaces, quotes, "=" or control characters are quoted.
+type LogfmtEncoder struct{}
+
+// JSONEncoder writes messages as JSON objects, e.g.
+//
+//	{"time":"2018-01-02T15:04:05Z","level":"error","msg":"Connect failed","scope":"kafka","offset":42}
+type JSONEncoder struct{}
+
+// Encode implements the Encoder interface
+func (enc LogfmtEncoder) Encode(buffer *bytes.Buffer, entry Entry) {
+	enc.writePair(buffer, "time", entry.Time.Format(time.RFC3339Nano))
+	enc.writePair(buffer, "level", entry.Level.String())
+	enc.writePair(buffer, "msg", entry.Message)
+
+	for _, field := range entry.Fields {
+		enc.writePair(buffer, field.Key, formatFieldValue(field.Value))
+	}
+}
+
+func (enc LogfmtEncoder) writePair(buffer *bytes.Buffer, key string, value string) {
+	if buffer.Len() > 0 {
+		buffer.WriteByte(' ')
+	}
+	buffer.WriteString(key)
+	buffer.WriteByte('=')
+
+	if value == "" || strings.IndexFunc(value, needsQuotes) >= 0 {
+		buffer.WriteString(strconv.Quote(value))
+	} else {
+		buffer.WriteString(value)
+	}
+}
+
+func needsQuotes(r rune) bool {
+	return r <= ' ' || r == '=' || r == '"' || r == 0x7f
+}
+
+// formatFieldValue returns the logfmt representation of a field value
+func formatFieldValue(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return value
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case uint64:
+		return strconv.FormatUint(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	case time.Duration:
+		return value.String()
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	case error:
+		return value.Error()
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// Encode implements the Encoder interface
+func (enc JSONEncoder) Encode(buffer *bytes.Buffer, entry Entry) {
+	buffer.WriteByte('{')
+	enc.writePair(buffer, "time", entry.Time.Format(time.RFC3339Nano))
+	buffer.WriteByte(',')
+	enc.writePair(buffer, "level", entry.Level.String())
+	buffer.WriteByte(',')
+	enc.writePair(buffer, "msg", entry.Message)
+
+	for _, field := range entry.Fields {
+		buffer.WriteByte(',')
+		enc.writePair(buffer, field.Key, field.Value)
+	}
+	buffer.WriteByte('}')
+}
+
+func (enc JSONEncoder) writePair(buffer *bytes.Buffer, key string, value interface{}) {
+	enc.writeValue(buffer, key)
+	buffer.WriteByte(':')
+	enc.writeValue(buffer, value)
+}
+
+func (enc JSONEncoder) writeValue(buffer *bytes.Buffer, value interface{}) {
+	switch typed := value.(type) {
+	case float64:
+		if math.IsNaN(typed) || math.IsInf(typed, 0) {
+			value = formatFieldValue(typed) // JSON does not support NaN and Inf
+		}
+	case time.Duration, error:
+		value = formatFieldValue(typed)
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buffer.Write(data)
+}
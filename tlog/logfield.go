@@ -0,0 +1,80 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlog
+
+import (
+	"time"
+)
+
+// Field is a key/value pair attached to a structured log message.
+// Fields should be created by the typed constructors like String or Int, so
+// that Value holds one of string, int64, uint64, float64, bool,
+// time.Duration, time.Time or error. Values of other types are created by
+// Any and are encoded on a best effort basis.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// String creates a field holding a string
+func String(key string, value string) Field {
+	return Field{key, value}
+}
+
+// Int creates a field holding an integer. The value is stored as int64.
+func Int(key string, value int) Field {
+	return Field{key, int64(value)}
+}
+
+// Int64 creates a field holding a signed 64-bit integer
+func Int64(key string, value int64) Field {
+	return Field{key, value}
+}
+
+// Uint64 creates a field holding an unsigned 64-bit integer
+func Uint64(key string, value uint64) Field {
+	return Field{key, value}
+}
+
+// Float64 creates a field holding a floating point number
+func Float64(key string, value float64) Field {
+	return Field{key, value}
+}
+
+// Bool creates a field holding a boolean
+func Bool(key string, value bool) Field {
+	return Field{key, value}
+}
+
+// Duration creates a field holding a duration
+func Duration(key string, value time.Duration) Field {
+	return Field{key, value}
+}
+
+// Time creates a field holding a point in time
+func Time(key string, value time.Time) Field {
+	return Field{key, value}
+}
+
+// Err creates a field with the key "error" holding the given error
+func Err(err error) Field {
+	return Field{"error", err}
+}
+
+// Any creates a field holding an arbitrary value. JSONEncoder marshals the
+// value, LogfmtEncoder formats it with fmt.
+func Any(key string, value interface{}) Field {
+	return Field{key, value}
+}
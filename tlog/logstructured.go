@@ -0,0 +1,122 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlog
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// Logger writes structured log messages, i.e. messages with a list of typed
+// fields. Messages are filtered by the verbosity set by SetVerbosity,
+// formatted by the encoder set by SetEncoder and written to the writer set
+// by SetWriter.
+// Error messages get an additional "caller" field, similar to the file and
+// line number added to messages written to Error.
+type Logger struct {
+	fields []Field
+}
+
+var (
+	encoder   = Encoder(LogfmtEncoder{})
+	verbosity = VerbosityError
+)
+
+// SetEncoder defines the format of structured log messages. LogfmtEncoder
+// is used by default.
+func SetEncoder(enc Encoder) {
+	encoder = enc
+}
+
+// With creates a structured logger adding the given fields to each message.
+func With(fields ...Field) Logger {
+	return Logger{}.With(fields...)
+}
+
+// With creates a copy of the logger adding the given fields to each message
+// in addition to the fields of this logger.
+func (logger Logger) With(fields ...Field) Logger {
+	combined := make([]Field, 0, len(logger.fields)+len(fields))
+	combined = append(combined, logger.fields...)
+	return Logger{append(combined, fields...)}
+}
+
+// Error writes an error message if the verbosity is at least
+// VerbosityError.
+func (logger Logger) Error(message string, fields ...Field) {
+	logger.write(VerbosityError, message, fields)
+}
+
+// Warning writes a warning message if the verbosity is at least
+// VerbosityWarning.
+func (logger Logger) Warning(message string, fields ...Field) {
+	logger.write(VerbosityWarning, message, fields)
+}
+
+// Note writes a note if the verbosity is at least VerbosityNote.
+func (logger Logger) Note(message string, fields ...Field) {
+	logger.write(VerbosityNote, message, fields)
+}
+
+// Debug writes a debug message if the verbosity is VerbosityDebug.
+func (logger Logger) Debug(message string, fields ...Field) {
+	logger.write(VerbosityDebug, message, fields)
+}
+
+func (logger Logger) write(level Verbosity, message string, fields []Field) {
+	if level > verbosity {
+		return // ### return, filtered ###
+	}
+
+	entry := Entry{
+		Time:    time.Now(),
+		Level:   level,
+		Message: message,
+		Fields:  make([]Field, 0, len(logger.fields)+len(fields)+1),
+	}
+	entry.Fields = append(entry.Fields, logger.fields...)
+	entry.Fields = append(entry.Fields, fields...)
+
+	if level == VerbosityError {
+		// Skip write and Error
+		if _, file, line, ok := runtime.Caller(2); ok {
+			entry.Fields = append(entry.Fields, String("caller", fmt.Sprintf("%s:%d", filepath.Base(file), line)))
+		}
+	}
+
+	buffer := bytes.Buffer{}
+	encoder.Encode(&buffer, entry)
+	buffer.WriteByte('\n')
+	logEnabled.Write(buffer.Bytes())
+}
+
+// String returns the lowercase name of the verbosity level.
+func (level Verbosity) String() string {
+	switch level {
+	case VerbosityError:
+		return "error"
+	case VerbosityWarning:
+		return "warning"
+	case VerbosityNote:
+		return "note"
+	case VerbosityDebug:
+		return "debug"
+	default:
+		return fmt.Sprintf("verbosity(%d)", level)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func testEntry() Entry {
+	return Entry{
+		Time:    time.Date(2018, 1, 2, 15, 4, 5, 0, time.UTC),
+		Level:   VerbosityWarning,
+		Message: "Connect failed",
+		Fields: []Field{
+			String("plugin", "kafka"),
+			Int("partition", 3),
+			Int64("offset", -42),
+			Uint64("size", 1024),
+			Float64("ratio", 0.5),
+			Bool("retry", true),
+			Duration("backoff", 1500*time.Millisecond),
+			Time("since", time.Date(2018, 1, 2, 15, 0, 0, 0, time.UTC)),
+			Err(fmt.Errorf("connection refused")),
+			String("empty", ""),
+			Any("labels", []string{"a", "b"}),
+		},
+	}
+}
+
+func TestLogfmtEncoder(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	buffer := bytes.Buffer{}
+	LogfmtEncoder{}.Encode(&buffer, testEntry())
+	expect.Equal(`time=2018-01-02T15:04:05Z level=warning msg="Connect failed" plugin=kafka partition=3 offset=-42 size=1024 ratio=0.5 retry=true backoff=1.5s since=2018-01-02T15:00:00Z error="connection refused" empty="" labels="[a b]"`, buffer.String())
+
+	buffer.Reset()
+	LogfmtEncoder{}.Encode(&buffer, Entry{Level: VerbosityNote, Message: "a=\"b\"\n"})
+	expect.Contains(buffer.String(), ` level=note msg="a=\"b\"\n"`)
+}
+
+func TestJSONEncoder(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	buffer := bytes.Buffer{}
+	JSONEncoder{}.Encode(&buffer, testEntry())
+	expect.Equal(`{"time":"2018-01-02T15:04:05Z","level":"warning","msg":"Connect failed","plugin":"kafka","partition":3,"offset":-42,"size":1024,"ratio":0.5,"retry":true,"backoff":"1.5s","since":"2018-01-02T15:00:00Z","error":"connection refused","empty":"","labels":["a","b"]}`, buffer.String())
+
+	buffer.Reset()
+	JSONEncoder{}.Encode(&buffer, Entry{Fields: []Field{Float64("nan", math.NaN()), Any("func", func() {})}})
+	decoded := make(map[string]interface{})
+	expect.NoError(json.Unmarshal(buffer.Bytes(), &decoded))
+	expect.Equal("NaN", decoded["nan"])
+}
+
+func TestStructuredLogger(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	buffer := new(bytes.Buffer)
+	SetVerbosity(VerbosityWarning)
+	SetWriter(buffer)
+	defer SetWriter(os.Stderr)
+	defer SetVerbosity(VerbosityError)
+
+	logger := With(String("request", "r1"))
+	logger.Note("filtered")
+	expect.Equal(0, buffer.Len())
+
+	logger.With(Int("offset", 7)).Warning("Skipped message", Bool("retry", false))
+	expect.Contains(buffer.String(), " level=warning msg=\"Skipped message\" request=r1 offset=7 retry=false")
+	expect.False(strings.HasSuffix(buffer.String(), "\n"))
+
+	// The logger is not modified by With
+	buffer.Reset()
+	logger.Error("Failed")
+	expect.Contains(buffer.String(), " level=error msg=Failed request=r1 caller=logstructured_test.go:")
+	expect.False(strings.Contains(buffer.String(), "offset"))
+
+	// Scopes become fields
+	SetEncoder(JSONEncoder{})
+	defer SetEncoder(LogfmtEncoder{})
+
+	scope := NewLogScope("consumer")
+	subScope := scope.NewSubScope("kafka")
+
+	buffer.Reset()
+	subScope.With(Int64("offset", 42)).Warning("Rewind")
+	decoded := make(map[string]interface{})
+	if expect.NoError(json.Unmarshal(buffer.Bytes(), &decoded)) {
+		expect.Equal("consumer.kafka", decoded["scope"])
+		expect.Equal("Rewind", decoded["msg"])
+		expect.Equal(float64(42), decoded["offset"])
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package thttp
+
+import (
+	"strconv"
+	"strings"
+)
+
+// NegotiateContentType returns the offered media type preferred by the given
+// Accept header. Media ranges like "text/*" and "*/*" are supported. If an
+// offer is matched by more than one range, the quality value of the most
+// specific range is used. Offers with a quality value of 0 are not
+// acceptable. If multiple offers have the same quality, the one listed first
+// is returned, i.e. offers should be passed in order of preference.
+// An empty Accept header accepts all offers, so the first offer is
+// returned. If no offer is acceptable, an empty string is returned.
+func NegotiateContentType(accept string, offers ...string) string {
+	if len(offers) == 0 {
+		return "" // ### return, nothing offered ###
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offers[0] // ### return, everything is acceptable ###
+	}
+
+	ranges := parseAccept(accept)
+	bestOffer, bestQuality := "", 0.0
+	for _, offer := range offers {
+		if quality := acceptQuality(ranges, offer); quality > bestQuality {
+			bestOffer, bestQuality = offer, quality
+		}
+	}
+	return bestOffer
+}
+
+// mediaRange is a single entry of an Accept header
+type mediaRange struct {
+	mediaType string
+	subType   string
+	quality   float64
+}
+
+// parseAccept splits an Accept header into its media ranges. Parameters
+// other than the quality value are ignored. Invalid quality values are
+// treated as 1.
+func parseAccept(accept string) []mediaRange {
+	ranges := []mediaRange{}
+	for _, entry := range strings.Split(accept, ",") {
+		params := strings.Split(entry, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "" {
+			continue // ### continue, empty entry ###
+		}
+
+		parsed := mediaRange{mediaType: mediaType, subType: "*", quality: 1}
+		if slash := strings.IndexByte(mediaType, '/'); slash >= 0 {
+			parsed.mediaType, parsed.subType = mediaType[:slash], mediaType[slash+1:]
+		}
+
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if len(param) < 2 || (param[0] != 'q' && param[0] != 'Q') || param[1] != '=' {
+				continue // ### continue, not a quality value ###
+			}
+			if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q >= 0 && q <= 1 {
+				parsed.quality = q
+			}
+		}
+		ranges = append(ranges, parsed)
+	}
+	return ranges
+}
+
+// acceptQuality returns the quality value of the most specific media range
+// matching the given media type. If no range matches, 0 is returned.
+func acceptQuality(ranges []mediaRange, offer string) float64 {
+	offer = strings.ToLower(offer)
+	mediaType, subType := offer, ""
+	if slash := strings.IndexByte(offer, '/'); slash >= 0 {
+		mediaType, subType = offer[:slash], offer[slash+1:]
+	}
+
+	quality, specificity := 0.0, -1
+	for _, r := range ranges {
+		rangeSpecificity := 0
+		switch {
+		case r.mediaType == mediaType && r.subType == subType:
+			rangeSpecificity = 2
+		case r.mediaType == mediaType && r.subType == "*":
+			rangeSpecificity = 1
+		case r.mediaType == "*" && r.subType == "*":
+			rangeSpecificity = 0
+		default:
+			continue // ### continue, no match ###
+		}
+
+		if rangeSpecificity > specificity || (rangeSpecificity == specificity && r.quality > quality) {
+			quality, specificity = r.quality, rangeSpecificity
+		}
+	}
+	return quality
+}
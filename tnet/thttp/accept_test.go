@@ -0,0 +1,42 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package thttp
+
+import (
+	"testing"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestNegotiateContentType(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	expect.Equal("text/plain", NegotiateContentType("", "text/plain", "application/json"))
+	expect.Equal("text/plain", NegotiateContentType("*/*", "text/plain", "application/json"))
+	expect.Equal("application/json", NegotiateContentType("application/json", "text/plain", "application/json"))
+	expect.Equal("application/json", NegotiateContentType("text/plain;q=0.5, application/json", "text/plain", "application/json"))
+	expect.Equal("application/json", NegotiateContentType("Application/JSON;Q=0.9, text/*;q=0.8", "text/plain", "application/json"))
+	expect.Equal("", NegotiateContentType("image/png", "text/plain", "application/json"))
+	expect.Equal("", NegotiateContentType("text/plain"))
+
+	// The most specific range wins, so q=0 excludes a type matched by */*
+	expect.Equal("application/json", NegotiateContentType("text/plain;q=0, */*", "text/plain", "application/json"))
+	expect.Equal("text/plain", NegotiateContentType("text/*;q=0.1, text/plain", "text/plain", "application/json"))
+	expect.Equal("", NegotiateContentType("*/*;q=0", "text/plain", "application/json"))
+
+	// Invalid quality values are ignored
+	expect.Equal("text/plain", NegotiateContentType("text/plain;q=2, application/json;q=0.5", "text/plain", "application/json"))
+	expect.Equal("application/json", NegotiateContentType("text/plain;q=x;version=0.0.4, application/json", "application/json", "text/plain"))
+}